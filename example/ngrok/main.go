@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/brick-io/brock/sdk"
+	sdkhttp "github.com/brick-io/brock/sdk/http"
 	sdkotel "github.com/brick-io/brock/sdk/otel"
 )
 
@@ -16,22 +17,20 @@ func main() {
 	log := sdkotel.Log(ctx, os.Stdout)
 
 	nonce := sdk.Sprintf("%x", Nonce((24)))
-	srv := &http.Server{
-		Addr: ":8080",
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPost {
-				p, err := io.ReadAll(r.Body)
-				log.Log.Print("----:----------------------------------------------")
-				log.Log.Print("ERRS:", err)
-				log.Log.Print("HEAD:", r.Header)
-				log.Log.Print("BODY:", string(p))
-			}
-			ok := http.StatusOK
-			http.Error(w, http.StatusText(ok)+"with nonce="+nonce, ok)
-		}),
-	}
-	log.Log.Printf("running on %s with nonce=%s", srv.Addr, nonce)
-	log.Log.Print(srv.ListenAndServe())
+	cfg := &sdkhttp.ServeConfiguration{Addr: ":8080"}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			p, err := io.ReadAll(r.Body)
+			log.Log.Print("----:----------------------------------------------")
+			log.Log.Print("ERRS:", err)
+			log.Log.Print("HEAD:", r.Header)
+			log.Log.Print("BODY:", string(p))
+		}
+		ok := http.StatusOK
+		http.Error(w, http.StatusText(ok)+"with nonce="+nonce, ok)
+	})
+	log.Log.Printf("running on %s with nonce=%s", cfg.Addr, nonce)
+	log.Log.Print(sdkhttp.Serve(ctx, cfg, handler))
 }
 
 func Nonce(n int) []byte {
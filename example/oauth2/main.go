@@ -65,11 +65,11 @@ func main() {
 		}
 	}))
 
-	srv2 := http.Server{Addr: ":9096", Handler: mux}
-
 	go func() { doclient() }()
 
-	log.Fatal(srv2.ListenAndServe())
+	if err := sdkhttp.Serve(context.Background(), &sdkhttp.ServeConfiguration{Addr: ":9096"}, mux); err != nil {
+		log.Fatal(err)
+	}
 }
 
 //nolint:gochecknoglobals
@@ -221,10 +221,16 @@ func handleLogin() http.Handler {
 		case http.MethodGet:
 			handleWrite(http.StatusOK, text).ServeHTTP(w, r)
 		case http.MethodPost:
-			err := r.ParseForm()
+			var form struct {
+				Username string `form:"username"`
+				Password string `form:"password"`
+				Action   string `query:"a"`
+			}
+
+			err := sdkhttp.Bind(r, &form)
 			_ = err
-			// _,_=sdk.Println("\n  handleLogin FORM", err, r.Form)
-			un, pw := r.Form.Get("username"), r.Form.Get("password")
+			// _,_=sdk.Println("\n  handleLogin FORM", err, form)
+			un, pw := form.Username, form.Password
 			if len(un) < 1 || len(pw) < 1 {
 				handleWrite(http.StatusBadRequest, text1).ServeHTTP(w, r)
 
@@ -250,7 +256,7 @@ func handleLogin() http.Handler {
 				http.SetCookie(w, old)
 			}
 
-			if a, err := getAction(r.Form.Get("a")); err == nil && len(a) > 0 && a.Get("next") != "" {
+			if a, err := getAction(form.Action); err == nil && len(a) > 0 && a.Get("next") != "" {
 				http.Redirect(w, r, a.Get("next"), http.StatusTemporaryRedirect)
 
 				return
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	sdkcrypto "github.com/brick-io/brock/sdk/crypto"
+	sdkhttp "github.com/brick-io/brock/sdk/http"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+)
+
+// Decode the panic recovery code sealed by the sdkhttp mux.
+//
+//	go run ./example/recovery-code -generate
+//	curl -si http://localhost:8080/panic | go run ./example/recovery-code -key "$RECOVERY_PRIVATE_KEY"
+func main() {
+	ctx := context.Background()
+	log := sdkotel.Log(ctx, os.Stderr)
+
+	generate := flag.Bool("generate", false, "generate the operator keypair")
+	key := flag.String("key", os.Getenv("RECOVERY_PRIVATE_KEY"), "base64 of the operator private key")
+	code := flag.String("code", "", "value of the "+sdkhttp.HeaderRecoveryCode+" response header, "+
+		"default to the one in the stdin of curl -si")
+	flag.Parse()
+
+	if *generate {
+		pub, pvt, err := sdkcrypto.NaCl.Box.Generate()
+		if err != nil {
+			log.Fatal().Err(err).Msg("generate")
+		}
+
+		_, _ = os.Stdout.WriteString("public:  " + btoa(pub[:]) + "\nprivate: " + btoa(pvt[:]) + "\n")
+
+		return
+	}
+
+	pvt, err := atob(*key)
+	if err != nil || len(pvt) != 32 {
+		log.Fatal().Err(err).Msg("invalid private key")
+	}
+
+	body, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatal().Err(err).Msg("read payload")
+	}
+
+	var k [32]byte
+
+	copy(k[:], pvt)
+
+	if *code == "" {
+		*code = headerValue(string(body), sdkhttp.HeaderRecoveryCode)
+	}
+
+	plain, err := sdkhttp.OpenRecoveryCode(*code, string(body), &k)
+	if err != nil {
+		log.Fatal().Err(err).Msg("open")
+	}
+
+	_, _ = os.Stdout.WriteString(plain + "\n")
+}
+
+// headerValue find the header in the response head printed by curl -si.
+func headerValue(response, key string) string {
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(k), key) {
+			return strings.TrimSpace(v)
+		}
+	}
+
+	return ""
+}
+
+//nolint:gochecknoglobals
+var (
+	atob = base64.RawStdEncoding.DecodeString
+	btoa = base64.RawStdEncoding.EncodeToString
+)
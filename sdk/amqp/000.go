@@ -6,6 +6,7 @@ import (
 	"github.com/rabbitmq/amqp091-go"
 
 	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
 )
 
 // Open ...
@@ -125,7 +126,8 @@ func Consume(ctx context.Context, req *ConsumeRequest, h ConsumeHandler) func(*C
 	}
 }
 
-// Publish ...
+// Publish the message, the request ID from the context is used as the
+// CorrelationId when it's not set.
 func Publish(ctx context.Context, ch *Channel, req *PublishRequest) (*Confirmation, *Return, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -134,7 +136,12 @@ func Publish(ctx context.Context, ch *Channel, req *PublishRequest) (*Confirmati
 		return nil, nil, err
 	}
 
-	err := ch.PublishWithContext(ctx, req.Exchange, req.Key, req.Mandatory, req.Immediate, req.Msg)
+	msg := req.Msg
+	if msg.CorrelationId == "" {
+		msg.CorrelationId = sdkotel.RequestIDFromContext(ctx)
+	}
+
+	err := ch.PublishWithContext(ctx, req.Exchange, req.Key, req.Mandatory, req.Immediate, msg)
 	if err != nil {
 		return nil, nil, err
 	}
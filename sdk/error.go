@@ -72,3 +72,25 @@ func (errs Errors) Filter(fn func(error) bool) Errors {
 
 	return IfThenElse(len(out) < 1, nil, out)
 }
+
+// Is reports whether any of the errors matches the target.
+func (errs Errors) Is(target error) bool {
+	for _, each := range errs {
+		if each != nil && errors.Is(each, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first of the errors that matches the target.
+func (errs Errors) As(target any) bool {
+	for _, each := range errs {
+		if each != nil && errors.As(each, target) {
+			return true
+		}
+	}
+
+	return false
+}
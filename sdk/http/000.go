@@ -3,8 +3,13 @@ package sdkhttp
 import (
 	"net/http"
 	"net/url"
+	"strconv"
+
+	"github.com/brick-io/brock/sdk"
 )
 
+var ErrNamedArgNotFound = sdk.Errorf("brock/sdkhttp: named argument not found")
+
 type ctxKeyNamedArguments struct{}
 
 // NamedArgsFromRequest is a helper function that extract url.Values that have
@@ -17,6 +22,57 @@ func NamedArgsFromRequest(r *http.Request) url.Values {
 	return u
 }
 
+// NamedArgs is the url.Values parsed from the pattern with typed accessors.
+//
+//	id, err := sdkhttp.NamedArgs(sdkhttp.NamedArgsFromRequest(r)).Int("id")
+type NamedArgs url.Values
+
+// Get the first value associated with the given key.
+func (x NamedArgs) Get(key string) string { return url.Values(x).Get(key) }
+
+// Has checks whether a given key is set.
+func (x NamedArgs) Has(key string) bool { return url.Values(x).Has(key) }
+
+// Int parse the value associated with the given key as int.
+func (x NamedArgs) Int(key string) (int, error) {
+	v, err := x.Int64(key)
+
+	return int(v), err
+}
+
+// Int64 parse the value associated with the given key as int64.
+func (x NamedArgs) Int64(key string) (int64, error) {
+	return parseNamedArg(x, key, func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) })
+}
+
+// Uint64 parse the value associated with the given key as uint64.
+func (x NamedArgs) Uint64(key string) (uint64, error) {
+	return parseNamedArg(x, key, func(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) })
+}
+
+// Float64 parse the value associated with the given key as float64.
+func (x NamedArgs) Float64(key string) (float64, error) {
+	return parseNamedArg(x, key, func(s string) (float64, error) { return strconv.ParseFloat(s, 64) })
+}
+
+// Bool parse the value associated with the given key as bool.
+func (x NamedArgs) Bool(key string) (bool, error) {
+	return parseNamedArg(x, key, strconv.ParseBool)
+}
+
+func parseNamedArg[T any](x NamedArgs, key string, parse func(string) (T, error)) (T, error) {
+	if !x.Has(key) {
+		return *new(T), sdk.Errorf("%w: %s", ErrNamedArgNotFound, key)
+	}
+
+	v, err := parse(x.Get(key))
+	if err != nil {
+		return v, &sdk.WrapError{Err: err, Msg: "brock/sdkhttp: named argument: " + key}
+	}
+
+	return v, nil
+}
+
 type ctxKeyPanicRecovery struct{}
 
 // PanicRecoveryFromRequest is a helper function that extract error value
@@ -25,3 +81,25 @@ type ctxKeyPanicRecovery struct{}
 func PanicRecoveryFromRequest(r *http.Request) any {
 	return Request.Get(r, ctxKeyPanicRecovery{})
 }
+
+type ctxKeyAllowedMethods struct{}
+
+// AllowedMethodsFromRequest is a helper function that extract the methods
+// registered for the requested path, the value is saved to *http.Request
+// right before calling mux.MethodNotAllowedHandler or mux.OptionsHandler.
+func AllowedMethodsFromRequest(r *http.Request) []string {
+	methods, _ := Request.Get(r, ctxKeyAllowedMethods{}).([]string)
+
+	return methods
+}
+
+type ctxKeyRoutePattern struct{}
+
+// RoutePatternFromRequest is a helper function that extract the pattern of
+// the route matched by the mux, the value is saved to *http.Request right
+// before calling the handler, so the wrapping handler could read it after.
+func RoutePatternFromRequest(r *http.Request) string {
+	pattern, _ := Request.Get(r, ctxKeyRoutePattern{}).(string)
+
+	return pattern
+}
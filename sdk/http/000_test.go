@@ -1,24 +1,69 @@
 package sdkhttp_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/brick-io/brock/sdk"
+	sdkcrypto "github.com/brick-io/brock/sdk/crypto"
 	sdkhttp "github.com/brick-io/brock/sdk/http"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
 )
 
 func Test_sdkhttp(t *testing.T) {
 	t.Parallel()
 
 	_ = t.Run("middleware", testMiddleware)
+	_ = t.Run("middleware/problem", testMiddlewareProblem)
 	_ = t.Run("mux/handle", testMuxHandle)
 	_ = t.Run("mux", testMux)
+	_ = t.Run("mux/tree", testMuxTree)
+	_ = t.Run("mux/group", testMuxGroup)
+	_ = t.Run("mux/method", testMuxMethod)
+	_ = t.Run("mux/constraint", testMuxConstraint)
+	_ = t.Run("mux/url", testMuxURL)
+	_ = t.Run("mux/case", testMuxCase)
+	_ = t.Run("mux/openapi", testMuxOpenAPI)
+	_ = t.Run("mux/host", testMuxHost)
+	_ = t.Run("mux/recovery", testMuxRecovery)
+	_ = t.Run("mux/otel", testMuxOtel)
+	_ = t.Run("bind", testBind)
+	_ = t.Run("render", testRender)
+	_ = t.Run("sse", testSSE)
+	_ = t.Run("websocket", testWebSocket)
+	_ = t.Run("client", testClient)
+	_ = t.Run("client/request", testClientRequest)
+	_ = t.Run("compress", testCompress)
+	_ = t.Run("ratelimit", testRateLimit)
+	_ = t.Run("cors", testCORS)
+	_ = t.Run("serve", testServe)
+	_ = t.Run("etag", testETag)
+	_ = t.Run("requestid", testRequestID)
+	_ = t.Run("idempotency", testIdempotency)
 }
 
 func testMiddleware(t *testing.T) {
@@ -67,6 +112,84 @@ func testMiddleware(t *testing.T) {
 	Expect(string(p)).To(Equal(str + " "))
 }
 
+func testMiddlewareProblem(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	next := func(err error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sdkhttp.Wrap.Handler(w, r).Next(err)
+		})
+	}
+
+	buf := new(bytes.Buffer)
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		w, r := newMockHandler("GET", "/users/7?a=b", nil)
+		ctx := trace.ContextWithSpanContext(r.Context(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID, SpanID: spanID,
+		}))
+		sdkhttp.Wrap.Middleware(h).ServeHTTP(w, r.WithContext(sdkotel.Log(ctx, buf).Context(ctx)))
+
+		return w
+	}
+
+	w := serve(next(&sdkhttp.StatusError{Code: http.StatusConflict, Type: "/problems/duplicate", Err: &sdk.WrapError{
+		Err: sdk.Errorf("pq: duplicate key value"), Msg: "insert user", Redact: "the email is already registered",
+	}}))
+	Expect(w.Code).To(Equal(http.StatusConflict))
+	Expect(w.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+	Expect(w.Body.String()).To(MatchJSON(`{
+		"type": "/problems/duplicate",
+		"title": "Conflict",
+		"status": 409,
+		"detail": "the email is already registered",
+		"instance": "/users/7?a=b",
+		"traceId": "4bf92f3577b34da6a3ce929d0e0e4736"
+	}`))
+	Expect(buf.String()).To(ContainSubstring(`"errors":["insert user","pq: duplicate key value"]`))
+	Expect(buf.String()).To(ContainSubstring(`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`))
+
+	// the chain without the Redact is only logged
+	buf.Reset()
+	w = serve(next(&sdkhttp.StatusError{Code: http.StatusConflict, Err: &sdk.WrapError{
+		Err: sdk.Errorf("pq: duplicate key value"), Msg: "insert user",
+	}}))
+	Expect(w.Code).To(Equal(http.StatusConflict))
+	Expect(w.Body.String()).To(ContainSubstring(`"detail":"Conflict"`))
+	Expect(w.Body.String()).NotTo(ContainSubstring("pq:"))
+	Expect(buf.String()).To(ContainSubstring(`"level":"warn"`))
+	Expect(buf.String()).To(ContainSubstring(`"errors":["insert user","pq: duplicate key value"]`))
+
+	buf.Reset()
+	w = serve(next(sdk.Errorf("dial tcp: connection refused")))
+	Expect(w.Code).To(Equal(http.StatusInternalServerError))
+	Expect(w.Body.String()).NotTo(ContainSubstring("dial tcp"))
+	Expect(buf.String()).To(ContainSubstring(`"level":"error"`))
+
+	w = serve(next(sdk.Errors{&sdk.FieldError{Field: "Name", Rule: "required"}}))
+	Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+	Expect(w.Body.String()).To(ContainSubstring(`Name is required`))
+
+	w = serve(sdkhttp.Wrap.Middleware(next(sdk.Errorf("handled")), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = sdkhttp.Wrap.Handler(w, r).Send(http.StatusAccepted, nil, nil)
+	})))
+	Expect(w.Code).To(Equal(http.StatusAccepted))
+	Expect(w.Body.String()).To(BeEmpty())
+
+	// the handler that writes directly has sent the response
+	w = serve(sdkhttp.Wrap.Middleware(next(sdk.Errorf("handled")), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "teapot", http.StatusTeapot)
+	})))
+	Expect(w.Code).To(Equal(http.StatusTeapot))
+	Expect(w.Body.String()).To(Equal("teapot\n"))
+
+	w = serve(next(nil))
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Body.String()).To(BeEmpty())
+}
+
 func testMuxHandle(t *testing.T) {
 	t.Parallel()
 	Expect := NewWithT(t).Expect
@@ -85,7 +208,13 @@ func testMuxHandle(t *testing.T) {
 		"pattern_1": {func() { mux.Handle("GET", "/aku/{id}{v}", nil) }, "pattern: need separator"},
 		"pattern_2": {func() { mux.Handle("GET", "/aku/{id}/mau/{}", nil) }, "pattern: empty key"},
 		"pattern_3": {func() { mux.Handle("GET", "/aku/{id}/mau/{id}", nil) }, "pattern: duplicate key: id"},
+		"pattern_4": {func() { mux.Handle("GET", "/aku/{id:[a-z}", nil) }, "pattern: invalid constraint: {id:[a-z}"},
+		"pattern_5": {func() { mux.Handle("GET", "/aku/{path...}/mau", nil) }, "pattern: catch-all should be the last segment: {path...}"},
+		"pattern_6": {func() { mux.Handle("GET", "/aku/x{path...}", nil) }, "pattern: catch-all should be the last segment: {path...}"},
+		"pattern_7": {func() { mux.Handle("GET", "/aku/{id", nil) }, "pattern: unclosed key: {id"},
+		"pattern_8": {func() { mux.Handle("GET", "/aku/{id:a/b}", nil) }, "pattern: invalid constraint: {id:a/b}"},
 		"ok":        {func() { mux.Handle("GET", "/aku/{id}/mau/{v}/makan/nasi/{tipe}", nil) }, ""},
+		"ok_1":      {func() { mux.Handle("GET", "/aku/{id:int}/{slug:[a-z0-9-]{2,}}/{rest...}", nil) }, ""},
 	}
 
 	for name, test := range tests {
@@ -112,7 +241,7 @@ func testMux(t *testing.T) {
 		sdkhttp.Header.WithKV("X-Content-Type-Options", "nosniff"),
 	)
 	mux := sdkhttp.Mux().
-		Handle("GET,PUT,PATCH", "/aku/{id}_{v}/makan/{tipe}", handler).
+		Handle("GET,PUT,PATCH", "/aku/{id}_{v}/makan/{tipe...}", handler).
 		Handle("GET,PUT,PATCH", "/aku", handler)
 	{
 		w, r := newMockHandler("GET", "/aku/123_mau/makan/nasi/goreng", nil)
@@ -128,7 +257,9 @@ func testMux(t *testing.T) {
 	{
 		w, r := newMockHandler("POST", "/aku/123_mau/makan/nasi/goreng", nil)
 		mux.ServeHTTP(w, r)
-		if ar := (assertResponse{w, http.StatusNotFound, h, []byte("Not Found\n")}); !ar.Equal() {
+		h := h.Clone()
+		h.Set("Allow", "GET, HEAD, PUT, PATCH, OPTIONS")
+		if ar := (assertResponse{w, http.StatusMethodNotAllowed, h, []byte("Method Not Allowed\n")}); !ar.Equal() {
 			t.Fatalf(ar.Format(), ar.Args()...)
 		}
 	}
@@ -148,6 +279,1759 @@ func testMux(t *testing.T) {
 	}
 }
 
+func testMuxTree(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		})
+	}
+	mux := sdkhttp.Mux().
+		Handle("GET", "/users/{id}", named("user")).
+		Handle("GET", "/users/me", named("me")).
+		Handle("GET", "/users/{id}/posts/{post}", named("post")).
+		Handle("GET", "/users/{id}_{v}/posts/{post}", named("post_v")).
+		Handle("POST", "/users", named("create"))
+
+	for i := 0; i < 20; i++ {
+		w, r := newMockHandler("GET", "/users/me", nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Body.String()).To(Equal("me"))
+		Expect(sdkhttp.NamedArgsFromRequest(r)).To(BeEmpty())
+
+		w, r = newMockHandler("GET", "/users/123", nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Body.String()).To(Equal("user"))
+		Expect(sdkhttp.NamedArgsFromRequest(r).Get("id")).To(Equal("123"))
+
+		w, r = newMockHandler("GET", "/users/123_abc/posts/9", nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Body.String()).To(Equal("post_v"))
+		Expect(sdkhttp.NamedArgsFromRequest(r).Get("v")).To(Equal("abc"))
+
+		w, r = newMockHandler("GET", "/users/123/posts/9", nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Body.String()).To(Equal("post"))
+		Expect(sdkhttp.NamedArgsFromRequest(r).Get("post")).To(Equal("9"))
+
+		w, r = newMockHandler("DELETE", "/users/123", nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+
+		w, r = newMockHandler("GET", "/posts/123", nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+	}
+}
+
+func testMuxGroup(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	write := func(s string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, s)
+		})
+	}
+	deny := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			_, _ = sdkhttp.Wrap.Handler(w, r).Send(http.StatusUnauthorized, nil, nil)
+		}
+	})
+
+	tag := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Group", "v1")
+	})
+
+	mux := sdkhttp.Mux()
+	v1 := mux.Group("/v1", tag)
+	v1.Handle("GET", "/ping", write("pong"))
+	v1.Group("/admin", deny).
+		Handle("GET", "/", write("admin")).
+		Handle("GET", "/users/{id}", write("user"))
+
+	Expect(func() { mux.Group("v2") }).To(PanicWith("prefix: should be canonical: use \"/v2\" instead of \"v2\""))
+	Expect(func() { v1.Handle("GET", "/Ping", nil) }).To(PanicWith("path: should be canonical: use \"/ping\" instead of \"/Ping\""))
+
+	w, r := newMockHandler("GET", "/v1/ping", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("pong"))
+	Expect(w.Header().Get("X-Group")).To(Equal("v1"))
+
+	w, r = newMockHandler("GET", "/v1/admin", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusUnauthorized))
+	Expect(w.Header().Get("X-Group")).To(Equal("v1"))
+
+	w, r = newMockHandler("GET", "/v1/admin/users/7", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("user"))
+	Expect(sdkhttp.NamedArgsFromRequest(r).Get("id")).To(Equal("7"))
+}
+
+func testMuxMethod(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		_, _ = io.WriteString(w, "body")
+	})
+	mux := sdkhttp.Mux().
+		Handle("GET", "/items/{id}", handler).
+		Handle("DELETE", "/items/{id}", handler).
+		Handle("POST", "/items", handler).
+		Handle("GET,OPTIONS", "/custom", handler)
+
+	w, r := newMockHandler("PUT", "/items/1", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	Expect(w.Header().Get("Allow")).To(Equal("GET, HEAD, DELETE, OPTIONS"))
+
+	w, r = newMockHandler("OPTIONS", "/items", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusNoContent))
+	Expect(w.Header().Get("Allow")).To(Equal("POST, OPTIONS"))
+
+	w, r = newMockHandler("OPTIONS", "/custom", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Header().Get("X-Method")).To(Equal("OPTIONS"))
+
+	w, r = newMockHandler("HEAD", "/items/1", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("X-Method")).To(Equal("HEAD"))
+	Expect(w.Body.Len()).To(BeZero())
+
+	mux.HandleMethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Join(sdkhttp.AllowedMethodsFromRequest(r), "|"))
+	}))
+	w, r = newMockHandler("PATCH", "/items", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("POST|OPTIONS"))
+
+	// the GET route is not matched for the other methods
+	w, r = newMockHandler("PATCH", "/items/1", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("GET|HEAD|DELETE|OPTIONS"))
+	Expect(sdkhttp.NamedArgsFromRequest(r).Get("id")).To(BeEmpty())
+}
+
+func testMuxConstraint(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		})
+	}
+	mux := sdkhttp.Mux().
+		Handle("GET", "/items/{id:int}", named("int")).
+		Handle("GET", "/items/{uuid:uuid}", named("uuid")).
+		Handle("GET", "/items/{slug:[a-z0-9-]+}", named("slug")).
+		Handle("GET", "/items/{name}", named("name")).
+		Handle("GET", "/files/{path...}", named("files"))
+
+	for target, name := range map[string]string{
+		"/items/42": "int",
+		"/items/6ba7b810-9dad-11d1-80b4-00c04fd430c8": "uuid",
+		"/items/nasi-goreng":                          "slug",
+		"/items/nasi_goreng":                          "name",
+		"/files/a/b/c.txt":                            "files",
+	} {
+		w, r := newMockHandler("GET", target, nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Body.String()).To(Equal(name), target)
+	}
+
+	w, r := newMockHandler("GET", "/items/42", nil)
+	mux.ServeHTTP(w, r)
+	id, err := sdkhttp.NamedArgs(sdkhttp.NamedArgsFromRequest(r)).Int("id")
+	Expect(err).To(Succeed())
+	Expect(id).To(Equal(42))
+	_, err = sdkhttp.NamedArgs(sdkhttp.NamedArgsFromRequest(r)).Int("missing")
+	Expect(err).To(MatchError(sdkhttp.ErrNamedArgNotFound))
+
+	w, r = newMockHandler("GET", "/items/nasi_goreng", nil)
+	mux.ServeHTTP(w, r)
+	_, err = sdkhttp.NamedArgs(sdkhttp.NamedArgsFromRequest(r)).Int("name")
+	Expect(err).To(HaveOccurred())
+
+	w, r = newMockHandler("GET", "/files/a/b/c.txt", nil)
+	mux.ServeHTTP(w, r)
+	Expect(sdkhttp.NamedArgsFromRequest(r).Get("path")).To(Equal("a/b/c.txt"))
+
+	var args url.Values = sdkhttp.NamedArgsFromRequest(r)
+	Expect(args.Encode()).To(Equal("path=a%2Fb%2Fc.txt"))
+
+	w, r = newMockHandler("GET", "/files", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusNotFound))
+}
+
+func testMuxURL(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	mux := sdkhttp.Mux().
+		Handle("GET,POST", "/oauth2/consent", nil).Name("consent").
+		Handle("GET", "/users/{id:int}/posts/{slug}", nil).Name("post")
+	mux.Group("/files").Handle("GET", "/{path...}", nil).Name("file")
+
+	Expect(func() { mux.Name("") }).To(PanicWith("name: empty"))
+	Expect(func() { mux.Name("consent") }).To(PanicWith("name: duplicate: consent"))
+
+	u, err := mux.URL("consent", nil)
+	Expect(err).To(Succeed())
+	Expect(u).To(Equal("/oauth2/consent"))
+
+	u, err = mux.URL("post", url.Values{"id": {"7"}, "slug": {"hello world"}})
+	Expect(err).To(Succeed())
+	Expect(u).To(Equal("/users/7/posts/hello%20world"))
+
+	u, err = mux.URL("file", url.Values{"path": {"a/b c/d.txt"}})
+	Expect(err).To(Succeed())
+	Expect(u).To(Equal("/files/a/b%20c/d.txt"))
+
+	_, err = mux.URL("post", url.Values{"id": {"7"}})
+	Expect(err).To(MatchError(sdkhttp.ErrNamedArgNotFound))
+
+	_, err = mux.URL("post", url.Values{"id": {"seven"}, "slug": {"x"}})
+	Expect(err).To(MatchError(sdkhttp.ErrNamedArgInvalid))
+
+	_, err = mux.URL("unknown", nil)
+	Expect(err).To(MatchError(sdkhttp.ErrRouteNotFound))
+
+	// the built URL is served back by the mux
+	tags := sdkhttp.Mux().Handle("GET", "/t/{s:[a-z ]+}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, sdkhttp.NamedArgsFromRequest(r).Get("s"))
+	})).Name("t")
+
+	u, err = tags.URL("t", url.Values{"s": {"a b"}})
+	Expect(err).To(Succeed())
+	Expect(u).To(Equal("/t/a%20b"))
+
+	w, r := newMockHandler("GET", u, nil)
+	tags.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Body.String()).To(Equal("a b"))
+}
+
+func testMuxCase(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, sdkhttp.NamedArgsFromRequest(r).Get("token"))
+	})
+
+	mux := sdkhttp.Mux().Handle("GET", "/tokens/{token}", handler)
+	w, r := newMockHandler("GET", "/Tokens/aGVsbG8gV29ybGQ%2F", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("aGVsbG8gV29ybGQ/"))
+
+	Expect(func() { sdkhttp.Mux().Handle("GET", "/abc/{id}", handler).CaseSensitive(true) }).
+		To(PanicWith("case sensitive: should be configured before any route registered"))
+
+	mux = sdkhttp.Mux().CaseSensitive(true).Handle("GET", "/Tokens/{token}", handler)
+	w, r = newMockHandler("GET", "/Tokens/9m4e2mr0ui3e8a215n4g", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("9m4e2mr0ui3e8a215n4g"))
+	w, r = newMockHandler("GET", "/tokens/9m4e2mr0ui3e8a215n4g", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusNotFound))
+
+	mux = sdkhttp.Mux().TrailingSlash(http.StatusPermanentRedirect).Handle("GET", "/tokens/{token}", handler)
+	w, r = newMockHandler("GET", "/tokens/AbC/?x=1", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusPermanentRedirect))
+	Expect(w.Header().Get("Location")).To(Equal("/tokens/AbC?x=1"))
+	w, r = newMockHandler("GET", "/unknown/", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusNotFound))
+
+	// the redirect never leaves the host
+	mux = sdkhttp.Mux().TrailingSlash(http.StatusMovedPermanently).Handle("GET", "/{path...}", handler)
+	for target, location := range map[string]string{
+		"//evil.com/":       "/evil.com",
+		"///evil.com/":      "/evil.com",
+		"//evil.com/a/?x=1": "/evil.com/a?x=1",
+	} {
+		w, r = newMockHandler("GET", target, nil)
+		mux.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusMovedPermanently), target)
+		Expect(w.Header().Get("Location")).To(Equal(location), target)
+	}
+
+	mux = sdkhttp.Mux().TrailingSlash(http.StatusNotFound).Handle("GET", "/tokens/{token}", handler)
+	w, r = newMockHandler("GET", "/tokens/AbC/", nil)
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusNotFound))
+
+	Expect(func() { sdkhttp.Mux().TrailingSlash(http.StatusOK) }).To(PanicWith("trailing slash: invalid status code: 200"))
+}
+
+func testMuxOpenAPI(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	type user struct {
+		ID      int64     `json:"id"`
+		Name    string    `json:"name"`
+		Email   *string   `json:"email"`
+		Friends []*user   `json:"friends,omitempty"`
+		Created time.Time `json:"created_at"`
+	}
+
+	mux := sdkhttp.Mux().
+		Handle("GET", "/users/{id:int}", nil).Name("user").
+		Describe(sdkhttp.RouteDoc{Summary: "get user", Response: user{}}).
+		Handle("PUT,PATCH", "/users/{id:int}", nil).Name("update").
+		Describe(sdkhttp.RouteDoc{Request: &user{}, Response: user{}, Status: http.StatusAccepted}).
+		Handle("GET", "/files/{path...}", nil)
+
+	routes := mux.Routes()
+	Expect(routes).To(HaveLen(4))
+	Expect(routes[0].Pattern).To(Equal("/files/{path...}"))
+	Expect(routes[0].Params).To(Equal([]sdkhttp.RouteParam{{Name: "path", CatchAll: true}}))
+	Expect(routes[1].Method).To(Equal("GET"))
+	Expect(routes[2].Method).To(Equal("PUT"))
+	Expect(routes[3].Method).To(Equal("PATCH"))
+
+	doc := sdkhttp.OpenAPI(sdkhttp.OpenAPIInfo{Title: "test", Version: "1.0.0"}, routes)
+	Expect(doc.Paths).To(HaveKey("/files/{path}"))
+	Expect(doc.Paths).To(HaveKey("/users/{id}"))
+
+	op := doc.Paths["/users/{id}"]["get"]
+	Expect(op.OperationID).To(Equal("user"))
+	Expect(op.Parameters[0].Schema.Type).To(Equal("integer"))
+	Expect(op.Responses["200"].Content["application/json"].Schema.Ref).To(Equal("#/components/schemas/user"))
+	Expect(doc.Paths["/users/{id}"]["patch"].OperationID).To(Equal("update_patch"))
+	Expect(doc.Paths["/users/{id}"]["put"].Responses).To(HaveKey("202"))
+
+	schema := doc.Components.Schemas["user"]
+	Expect(schema.Required).To(Equal([]string{"id", "name", "created_at"}))
+	Expect(schema.Properties["email"].Nullable).To(BeTrue())
+	Expect(schema.Properties["friends"].Items.Ref).To(Equal("#/components/schemas/user"))
+	Expect(schema.Properties["created_at"].Format).To(Equal("date-time"))
+
+	// the same name from another package
+	type Route struct {
+		Path string `json:"path"`
+	}
+
+	ref := func(doc *sdkhttp.OpenAPIDocument, path string) string {
+		return doc.Paths[path]["get"].Responses["200"].Content["application/json"].Schema.Ref
+	}
+
+	routesDoc := sdkhttp.OpenAPI(sdkhttp.OpenAPIInfo{Title: "test", Version: "1.0.0"}, sdkhttp.Mux().
+		Handle("GET", "/a", nil).Describe(sdkhttp.RouteDoc{Response: sdkhttp.Route{}}).
+		Handle("GET", "/b", nil).Describe(sdkhttp.RouteDoc{Response: Route{}}).
+		Routes())
+	Expect(ref(routesDoc, "/a")).To(Equal("#/components/schemas/Route"))
+	Expect(ref(routesDoc, "/b")).To(Equal("#/components/schemas/github.com_brick-io_brock_sdk_http_test.Route"))
+	Expect(routesDoc.Components.Schemas["Route"].Properties).To(HaveKey("Pattern"))
+	Expect(routesDoc.Components.Schemas["github.com_brick-io_brock_sdk_http_test.Route"].Properties).To(HaveKey("path"))
+
+	// the routes of the different hosts share the path
+	Expect(func() {
+		sdkhttp.OpenAPI(sdkhttp.OpenAPIInfo{}, sdkhttp.Mux().
+			Handle("GET", "api.example.com/users", nil).
+			Handle("GET", "admin.example.com/users", nil).
+			Routes())
+	}).To(PanicWith("openapi: duplicate operation: GET /users"))
+
+	w, r := newMockHandler("GET", "/openapi.json", nil)
+	doc.ServeHTTP(w, r)
+	Expect(w.Header().Get("Content-Type")).To(Equal("application/json; charset=utf-8"))
+	Expect(w.Body.String()).To(ContainSubstring(`"openapi":"3.0.3"`))
+
+	w, r = newMockHandler("GET", "/openapi.yaml", nil)
+	doc.ServeHTTP(w, r)
+	Expect(w.Header().Get("Content-Type")).To(Equal("application/yaml; charset=utf-8"))
+	Expect(w.Body.String()).To(ContainSubstring("openapi: 3.0.3"))
+}
+
+func testMuxHost(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		})
+	}
+	mux := sdkhttp.Mux().
+		Handle("GET", "/users/{id}", named("default")).
+		Handle("GET", "{tenant}.api.example.com/users/{id}", named("tenant")).Name("tenant").
+		Handle("GET", "admin.api.example.com/users/{id}", named("admin"))
+	mux.Group("{tenant:alpha}.example.com/v1").Handle("POST", "/users", named("group"))
+
+	Expect(func() { mux.Handle("GET", "API.example.com/x", nil) }).
+		To(PanicWith("path: should be canonical: use \"api.example.com/x\" instead of \"API.example.com/x\""))
+	Expect(func() { mux.Handle("GET", "{id}.example.com/{id}", nil) }).To(PanicWith("pattern: duplicate key: id"))
+
+	for host, name := range map[string]string{
+		"acme.api.example.com:8080": "tenant",
+		"ADMIN.api.example.com":     "admin",
+		"example.com":               "default",
+	} {
+		w, r := newMockHandler("GET", "/users/1", nil)
+		r.Host = host
+		mux.ServeHTTP(w, r)
+		Expect(w.Body.String()).To(Equal(name), host)
+	}
+
+	w, r := newMockHandler("GET", "/users/1", nil)
+	r.Host = "acme.api.example.com"
+	mux.ServeHTTP(w, r)
+	Expect(sdkhttp.NamedArgsFromRequest(r).Get("tenant")).To(Equal("acme"))
+	Expect(sdkhttp.NamedArgsFromRequest(r).Get("id")).To(Equal("1"))
+
+	w, r = newMockHandler("POST", "/v1/users", nil)
+	r.Host = "acme.example.com"
+	mux.ServeHTTP(w, r)
+	Expect(w.Body.String()).To(Equal("group"))
+
+	w, r = newMockHandler("GET", "/v1/users", nil)
+	r.Host = "acme.example.com"
+	mux.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	Expect(w.Header().Get("Allow")).To(Equal("POST, OPTIONS"))
+
+	u, err := mux.URL("tenant", url.Values{"tenant": {"acme"}, "id": {"1"}})
+	Expect(err).To(Succeed())
+	Expect(u).To(Equal("//acme.api.example.com/users/1"))
+
+	routes := mux.Routes()
+	Expect(routes).To(HaveLen(4))
+	Expect(routes[0].Host).To(BeEmpty())
+	Expect(routes[1].Host).To(Equal("admin.api.example.com"))
+}
+
+func testMuxRecovery(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	pub, pvt, err := sdkcrypto.NaCl.Box.Generate()
+	Expect(err).To(Succeed())
+
+	boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+
+	w, r := newMockHandler("GET", "/", nil)
+	sdkhttp.Mux().Handle("GET", "/", boom).ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusInternalServerError))
+	Expect(w.Header().Get(sdkhttp.HeaderRecoveryCode)).To(BeEmpty())
+	Expect(w.Body.String()).To(Equal("Internal Server Error\n"))
+
+	w, r = newMockHandler("GET", "/", nil)
+	sdkhttp.Mux().RecoveryKey(pub).Handle("GET", "/", boom).ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusInternalServerError))
+	Expect(w.Body.String()).NotTo(ContainSubstring("boom"))
+
+	header := w.Header().Get(sdkhttp.HeaderRecoveryCode)
+	plain, err := sdkhttp.OpenRecoveryCode(header, w.Body.String(), pvt)
+	Expect(err).To(Succeed())
+	Expect(plain).To(HavePrefix("boom\n\n"))
+	Expect(plain).To(ContainSubstring("goroutine"))
+
+	_, other, _ := sdkcrypto.NaCl.Box.Generate()
+	_, err = sdkhttp.OpenRecoveryCode(header, w.Body.String(), other)
+	Expect(err).To(MatchError(sdkhttp.ErrInvalidRecoveryCode))
+
+	header, payload, err := sdkhttp.SealRecoveryCode("sealed", pub)
+	Expect(err).To(Succeed())
+
+	plain, err = sdkhttp.OpenRecoveryCode(header, payload, pvt)
+	Expect(err).To(Succeed())
+	Expect(plain).To(Equal("sealed"))
+}
+
+func testMuxOtel(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tracer := &sdkotel.Tracer{Tracer: tp.Tracer("test")}
+	meter := &sdkotel.Meter{Meter: metric.NewNoopMeterProvider().Meter("test")}
+
+	mux := sdkhttp.Mux().
+		Handle("GET", "/users/{id:int}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		})).
+		Handle("GET", "/boom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+	h := sdkhttp.Instrument(tracer, meter, mux)
+
+	w, r := newMockHandler("GET", "/users/42", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusOK))
+
+	w, r = newMockHandler("GET", "/boom", nil)
+	h.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusInternalServerError))
+
+	w, r = newMockHandler("GET", "/nowhere", nil)
+	h.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusNotFound))
+
+	spans := rec.Ended()
+	Expect(spans).To(HaveLen(3))
+
+	Expect(spans[0].Name()).To(Equal("GET /users/{id:int}"))
+	Expect(spans[0].Parent().TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+	Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+
+	attrs := make(map[string]string)
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	Expect(attrs).To(HaveKeyWithValue("http.status_code", "200"))
+	Expect(attrs).To(HaveKeyWithValue("http.response_content_length", "2"))
+	Expect(attrs).To(HaveKeyWithValue("http.route", "/users/{id:int}"))
+
+	Expect(spans[1].Name()).To(Equal("GET /boom"))
+	Expect(spans[1].Status().Code).To(Equal(codes.Error))
+	Expect(spans[1].Events()).To(HaveLen(1))
+	Expect(spans[1].Events()[0].Name).To(Equal("exception"))
+
+	Expect(spans[2].Name()).To(Equal("HTTP GET"))
+}
+
+func testBind(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	type Address struct {
+		City string `json:"city" xml:"city" form:"city"`
+	}
+
+	type input struct {
+		ID      int64         `path:"id"`
+		Page    int           `query:"page"`
+		Tags    []string      `query:"tag"`
+		Timeout time.Duration `query:"timeout"`
+		Token   string        `header:"X-Token"`
+		Name    string        `json:"name" xml:"name" form:"name"`
+		Address Address       `json:"address" xml:"address"`
+		Since   *time.Time    `query:"since"`
+	}
+
+	bind := func(method, target, contentType, body string) (input, error) {
+		var in input
+
+		_, r := newMockHandler(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("X-Token", "secret")
+
+		var err error
+
+		sdkhttp.Mux().Handle("POST", "/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err = sdkhttp.Bind(r, &in)
+		})).ServeHTTP(httptest.NewRecorder(), r)
+
+		return in, err
+	}
+
+	in, err := bind("POST", "/users/7?page=2&tag=a&tag=b&timeout=3s&since=2022-01-02T03:04:05Z",
+		"application/json; charset=utf-8", `{"name":"budi","address":{"city":"jakarta"}}`)
+	Expect(err).To(Succeed())
+	Expect(in.ID).To(Equal(int64(7)))
+	Expect(in.Page).To(Equal(2))
+	Expect(in.Tags).To(Equal([]string{"a", "b"}))
+	Expect(in.Timeout).To(Equal(3 * time.Second))
+	Expect(in.Token).To(Equal("secret"))
+	Expect(in.Name).To(Equal("budi"))
+	Expect(in.Address.City).To(Equal("jakarta"))
+	Expect(in.Since.Year()).To(Equal(2022))
+
+	in, err = bind("POST", "/users/7", "application/xml", `<input><name>budi</name><address><city>bandung</city></address></input>`)
+	Expect(err).To(Succeed())
+	Expect(in.Name).To(Equal("budi"))
+	Expect(in.Address.City).To(Equal("bandung"))
+
+	in, err = bind("POST", "/users/7", "application/x-www-form-urlencoded", `name=budi&city=bogor`)
+	Expect(err).To(Succeed())
+	Expect(in.Name).To(Equal("budi"))
+	Expect(in.Address.City).To(Equal("bogor"))
+
+	buf := new(bytes.Buffer)
+	mw := sdkhttp.MultipartForm.Create(
+		sdkhttp.MultipartForm.WithWriter(buf),
+		sdkhttp.MultipartForm.WithField("name", "budi"),
+	)
+	Expect(mw.Close()).To(Succeed())
+
+	in, err = bind("POST", "/users/7", mw.FormDataContentType(), buf.String())
+	Expect(err).To(Succeed())
+	Expect(in.Name).To(Equal("budi"))
+
+	_, err = bind("POST", "/users/7", "application/octet-stream", `...`)
+	Expect(err).To(MatchError(sdkhttp.ErrUnsupportedMediaType))
+
+	_, err = bind("POST", "/users/x?page=two", "application/json", `{"name":1}`)
+
+	var errs sdk.Errors
+
+	Expect(errors.As(err, &errs)).To(BeTrue())
+	Expect(errs).To(HaveLen(3))
+
+	fields := make([]string, 0)
+
+	for _, err := range errs {
+		var bindErr *sdkhttp.BindError
+
+		Expect(errors.As(err, &bindErr)).To(BeTrue())
+		fields = append(fields, bindErr.Source+":"+bindErr.Field)
+	}
+
+	Expect(fields).To(ConsistOf("body:", "path:ID", "query:Page"))
+
+	Expect(sdkhttp.Bind(httptest.NewRequest("GET", "/", nil), input{})).To(MatchError(sdkhttp.ErrBindTarget))
+
+	type signup struct {
+		Name  string `json:"name"  validate:"required,min=3"`
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	signupHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in signup
+
+		wr := sdkhttp.Wrap.Handler(w, r)
+		if err := wr.Bind(&in); err != nil {
+			Expect(wr.Err()).To(Equal(err))
+
+			return
+		}
+
+		_, _ = wr.Render(http.StatusCreated, in)
+	})
+
+	for body, expect := range map[string]assertResponse{
+		`{"name":"budi","email":"budi@example.com"}`: {
+			code: http.StatusCreated,
+			body: []byte(`{"name":"budi","email":"budi@example.com"}`),
+		},
+		`{"name":"bu"}`: {
+			code: http.StatusUnprocessableEntity,
+			body: []byte(`"errors":[{"field":"Name","message":"Name must be at least 3"},` +
+				`{"field":"Email","message":"Email is required"}]}`),
+		},
+		`{"name":`: {
+			code: http.StatusBadRequest,
+			body: []byte(`"errors":[{"message":"body \"\": `),
+		},
+	} {
+		w, r := newMockHandler("POST", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+
+		if expect.code != http.StatusCreated {
+			// the failure is the problem regardless of the Accept
+			r.Header.Set("Accept", "text/html")
+		}
+
+		signupHandler.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(expect.code), body)
+
+		if expect.code != http.StatusCreated {
+			Expect(w.Header().Get("Content-Type")).To(Equal("application/problem+json"), body)
+			Expect(w.Body.String()).To(ContainSubstring(string(expect.body)), body)
+		}
+	}
+
+	w, r := newMockHandler("POST", "/", strings.NewReader(`name: budi`))
+	r.Header.Set("Content-Type", "text/plain")
+	signupHandler.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusUnsupportedMediaType))
+}
+
+func testRender(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	type payload struct {
+		XMLName sdk.XMLName `json:"-" xml:"payload" yaml:"-" toml:"-"`
+		Name    string      `json:"name" xml:"name" yaml:"name" toml:"name"`
+	}
+
+	render := func(accept string) (*httptest.ResponseRecorder, error) {
+		w, r := newMockHandler("GET", "/", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+
+		_, err := sdkhttp.Wrap.Handler(w, r).Render(http.StatusCreated, payload{Name: "brock"})
+
+		return w, err
+	}
+
+	for accept, expect := range map[string][2]string{
+		"":                                      {"application/json", `{"name":"brock"}`},
+		"*/*":                                   {"application/json", `{"name":"brock"}`},
+		"text/xml":                              {"application/xml", `<payload><name>brock</name></payload>`},
+		"application/json;q=0.5, */*;q=0.9":     {"application/xml", `<payload><name>brock</name></payload>`},
+		"application/*;q=0.1, application/yaml": {"application/yaml", "name: brock\n"},
+		"application/toml":                      {"application/toml", "name = \"brock\"\n"},
+	} {
+		w, err := render(accept)
+		Expect(err).To(Succeed(), accept)
+		Expect(w.Code).To(Equal(http.StatusCreated), accept)
+		Expect(w.Header().Get("Content-Type")).To(Equal(expect[0]+"; charset=utf-8"), accept)
+		Expect(w.Header().Get("Vary")).To(Equal("Accept"), accept)
+		Expect(w.Body.String()).To(Equal(expect[1]), accept)
+	}
+
+	w, err := render("text/html, application/json;q=0")
+	Expect(err).To(MatchError(sdkhttp.ErrNotAcceptable))
+	Expect(w.Code).To(Equal(http.StatusNotAcceptable))
+
+	w, r := newMockHandler("GET", "/", nil)
+	_, err = sdkhttp.Wrap.Handler(w, r).Stream([]byte("streamed"))
+	Expect(err).To(Succeed())
+	_, err = sdkhttp.Wrap.Handler(w, r).Render(http.StatusOK, payload{})
+	Expect(err).To(MatchError(sdkhttp.ErrAlreadyStreamed))
+}
+
+func testSSE(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	replay := sdkhttp.SSEMemoryReplay(2)
+	for _, id := range []string{"1", "2", "3"} {
+		replay.Append(sdkhttp.SSEEvent{ID: id, Data: "event " + id})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, r := newMockHandler("GET", "/events", nil)
+	r = r.WithContext(ctx)
+	r.Header.Set("Last-Event-ID", "2")
+
+	sse, err := sdkhttp.SSE(w, r, &sdkhttp.SSEConfiguration{
+		Heartbeat: 5 * time.Millisecond,
+		Retry:     3 * time.Second,
+		Replay:    replay,
+	})
+	Expect(err).To(Succeed())
+	Expect(sse.Send(sdkhttp.SSEEvent{ID: "4\n", Event: "update", Data: "line 1\r\nline 2"})).To(Succeed())
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	<-sse.Done()
+	Expect(sse.Send(sdkhttp.SSEEvent{Data: "gone"})).To(MatchError(context.Canceled))
+	sse.Close()
+
+	Expect(w.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+	Expect(w.Body.String()).To(HavePrefix("retry: 3000\n\n" +
+		"id: 3\ndata: event 3\n\n" +
+		"id: 4\nevent: update\ndata: line 1\ndata: line 2\n\n"))
+	Expect(w.Body.String()).To(ContainSubstring(": heartbeat\n\n"))
+	Expect(w.Body.String()).NotTo(ContainSubstring("gone"))
+
+	w, r = newMockHandler("GET", "/events", nil)
+	sse, err = sdkhttp.SSE(w, r, &sdkhttp.SSEConfiguration{Heartbeat: -1})
+	Expect(err).To(Succeed())
+	sse.Close()
+	Expect(sse.Send(sdkhttp.SSEEvent{Data: "closed"})).To(MatchError(sdkhttp.ErrSSEClosed))
+	Expect(w.Body.String()).To(Equal(": connected\n\n"))
+
+	_, r = newMockHandler("GET", "/events", nil)
+	_, err = sdkhttp.SSE(struct{ http.ResponseWriter }{httptest.NewRecorder()}, r)
+	Expect(err).To(MatchError(sdkhttp.ErrUnimplemented))
+}
+
+//nolint:funlen
+func testWebSocket(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	type message struct {
+		Text string `json:"text"`
+	}
+
+	closed := make(chan error, 1)
+	srv := httptest.NewServer(sdkhttp.Mux().Handle("GET", "/ws", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := sdkhttp.WebSocket(w, r, &sdkhttp.WebSocketConfiguration{
+			ReadLimit:    64,
+			PingInterval: -1,
+			Subprotocols: []string{"chat.v2", "chat.v1"},
+		})
+		if err != nil {
+			return
+		}
+
+		for {
+			var msg message
+			if err := ws.ReadJSON(&msg); err != nil {
+				closed <- err
+
+				return
+			}
+
+			_ = ws.WriteJSON(message{Text: strings.ToUpper(msg.Text) + " " + ws.Subprotocol})
+		}
+	})))
+	defer srv.Close()
+
+	dial := func(header string) (net.Conn, *bufio.Reader, *http.Response) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		Expect(err).To(Succeed())
+
+		_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: " + srv.Listener.Addr().String() + "\r\n" + header + "\r\n"))
+		Expect(err).To(Succeed())
+
+		br := bufio.NewReader(conn)
+		res, err := http.ReadResponse(br, nil)
+		Expect(err).To(Succeed())
+
+		return conn, br, res
+	}
+
+	writeFrame := func(conn net.Conn, opcode byte, p []byte) {
+		frame := []byte{0x80 | opcode, 0x80 | byte(len(p)), 1, 2, 3, 4}
+		for i := range p {
+			frame = append(frame, p[i]^frame[2+i%4])
+		}
+
+		_, err := conn.Write(frame)
+		Expect(err).To(Succeed())
+	}
+
+	readFrame := func(br *bufio.Reader) (byte, []byte) {
+		header := make([]byte, 2)
+		_, err := io.ReadFull(br, header)
+		Expect(err).To(Succeed())
+		Expect(header[1] & 0x80).To(BeZero())
+
+		p := make([]byte, header[1]&0x7f)
+		_, err = io.ReadFull(br, p)
+		Expect(err).To(Succeed())
+
+		return header[0] & 0x0f, p
+	}
+
+	handshake := "Connection: keep-alive, Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: chat.v1, chat.v2\r\n"
+
+	conn, br, res := dial(handshake)
+	defer conn.Close()
+
+	Expect(res.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+	Expect(res.Header.Get("Sec-WebSocket-Accept")).To(Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo="))
+	Expect(res.Header.Get("Sec-WebSocket-Protocol")).To(Equal("chat.v2"))
+
+	writeFrame(conn, 0x9, []byte("hi"))
+	opcode, p := readFrame(br)
+	Expect(opcode).To(Equal(byte(0xa)))
+	Expect(string(p)).To(Equal("hi"))
+
+	// fragmented text message
+	frame := []byte{0x01, 0x80 | 6, 0, 0, 0, 0}
+	_, _ = conn.Write(append(frame, []byte(`{"text`)...))
+	writeFrame(conn, 0x0, []byte(`":"hello"}`))
+
+	opcode, p = readFrame(br)
+	Expect(opcode).To(Equal(byte(sdkhttp.WebSocketText)))
+	Expect(string(p)).To(Equal(`{"text":"HELLO chat.v2"}`))
+
+	writeFrame(conn, 0x8, []byte{0x03, 0xe8, 'b', 'y', 'e'})
+	opcode, p = readFrame(br)
+	Expect(opcode).To(Equal(byte(0x8)))
+	Expect(p).To(Equal([]byte{0x03, 0xe8}))
+
+	err := <-closed
+	Expect(err).To(MatchError(sdkhttp.ErrWebSocketClosed))
+	Expect(err).To(Equal(&sdkhttp.WebSocketCloseError{Code: sdkhttp.WebSocketCloseNormal, Reason: "bye"}))
+
+	// the close code that must not be sent by the peer
+	for _, code := range []uint16{0, 999, 1004, 1005, 1006, 1015, 2999, 5000} {
+		conn, br, _ = dial(handshake)
+		defer conn.Close()
+
+		writeFrame(conn, 0x8, []byte{byte(code >> 8), byte(code)})
+		opcode, p = readFrame(br)
+		Expect(opcode).To(Equal(byte(0x8)), "%d", code)
+		Expect(p[:2]).To(Equal([]byte{0x03, 0xea}), "%d", code)
+		Expect(<-closed).To(MatchError(sdkhttp.ErrWebSocketProtocol), "%d", code)
+	}
+
+	// the application close code is replied with 1000
+	conn, br, _ = dial(handshake)
+	defer conn.Close()
+
+	writeFrame(conn, 0x8, []byte{0x0f, 0xa0})
+	opcode, p = readFrame(br)
+	Expect(opcode).To(Equal(byte(0x8)))
+	Expect(p).To(Equal([]byte{0x03, 0xe8}))
+	Expect(<-closed).To(Equal(&sdkhttp.WebSocketCloseError{Code: 4000}))
+
+	// message too big
+	conn, br, _ = dial(handshake)
+	defer conn.Close()
+
+	writeFrame(conn, 0x1, bytes.Repeat([]byte("a"), 100))
+	opcode, p = readFrame(br)
+	Expect(opcode).To(Equal(byte(0x8)))
+	Expect(p).To(Equal([]byte{0x03, 0xf1}))
+	Expect(<-closed).To(MatchError(sdkhttp.ErrWebSocketMessageTooBig))
+
+	// bad handshake
+	conn, _, res = dial("Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 8\r\n")
+	defer conn.Close()
+
+	Expect(res.StatusCode).To(Equal(http.StatusUpgradeRequired))
+	Expect(res.Header.Get("Sec-WebSocket-Version")).To(Equal("13"))
+
+	conn, _, res = dial(handshake + "Origin: https://evil.example\r\n")
+	defer conn.Close()
+
+	Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+}
+
+func testClient(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	var attempts int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"traceparent":"` + r.Header.Get("traceparent") + `"}`))
+		case "/later":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("upstream is down"))
+		}
+	}))
+	defer srv.Close()
+
+	c := sdkhttp.Client(&sdkhttp.ClientConfiguration{
+		Timeout:      5 * time.Second,
+		MaxRetries:   3,
+		RetryWaitMin: time.Millisecond,
+		RetryWaitMax: 10 * time.Millisecond,
+	})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/flaky", nil)
+	res, err := c.Do(req)
+	Expect(err).To(Succeed())
+
+	var out struct {
+		TraceParent string `json:"traceparent"`
+	}
+
+	Expect(sdkhttp.Decode(res, &out)).To(Succeed())
+	Expect(out.TraceParent).To(Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+
+	atomic.StoreInt32(&attempts, 0)
+	res, err = c.Post(srv.URL+"/down", "text/plain", strings.NewReader("not idempotent"))
+	Expect(err).To(Succeed())
+	Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+
+	err = sdkhttp.Decode(res, &out)
+
+	var statusErr *sdkhttp.StatusError
+
+	Expect(errors.As(err, &statusErr)).To(BeTrue())
+	Expect(statusErr.Code).To(Equal(http.StatusBadGateway))
+	Expect(err.Error()).To(ContainSubstring("upstream is down"))
+
+	atomic.StoreInt32(&attempts, 0)
+	req, _ = http.NewRequest("PUT", srv.URL+"/down", strings.NewReader("idempotent"))
+	res, err = c.Do(req)
+	Expect(err).To(Succeed())
+	Expect(res.StatusCode).To(Equal(http.StatusBadGateway))
+	Expect(res.Body.Close()).To(Succeed())
+	Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(4)))
+
+	atomic.StoreInt32(&attempts, 0)
+	res, err = c.Get(srv.URL + "/later")
+	Expect(err).To(Succeed())
+	Expect(res.StatusCode).To(Equal(http.StatusTooManyRequests))
+	Expect(res.Body.Close()).To(Succeed())
+	Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+}
+
+func testClientRequest(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := map[string]string{"content-type": r.Header.Get("Content-Type"), "query": r.URL.RawQuery}
+
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			out["name"] = r.MultipartForm.Value["name"][0]
+			f, _ := r.MultipartForm.File["file"][0].Open()
+			p, _ := io.ReadAll(f)
+			out["file"] = string(p)
+		} else {
+			p, _ := io.ReadAll(r.Body)
+			out["body"] = string(p)
+		}
+
+		_, _ = sdkhttp.Wrap.Handler(w, r).Render(http.StatusOK, out)
+	}))
+	defer srv.Close()
+
+	c := sdkhttp.Client(&sdkhttp.ClientConfiguration{MaxRetries: 1})
+	do := func(req *http.Request) (map[string]string, error) {
+		out := make(map[string]string)
+
+		res, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return out, sdkhttp.Decode(res, &out)
+	}
+
+	req, err := sdkhttp.NewRequest(context.Background(), "POST", srv.URL+"/?a=1",
+		sdkhttp.Header.WithKV("X-Token", "secret"),
+		sdkhttp.Query.WithKV("b", "2"),
+		sdkhttp.Body.WithJSON(map[string]int{"n": 1}),
+	)
+	Expect(err).To(Succeed())
+	Expect(req.Header.Get("X-Token")).To(Equal("secret"))
+	Expect(req.GetBody).NotTo(BeNil())
+
+	out, err := do(req)
+	Expect(err).To(Succeed())
+	Expect(out).To(Equal(map[string]string{"content-type": "application/json", "query": "a=1&b=2", "body": "{\"n\":1}\n"}))
+
+	req, err = sdkhttp.NewRequest(context.Background(), "PUT", srv.URL,
+		sdkhttp.MultipartForm.WithField("name", "avatar"),
+		sdkhttp.MultipartForm.WithFile("file", "avatar.txt", strings.NewReader("content")),
+	)
+	Expect(err).To(Succeed())
+
+	out, err = do(req)
+	Expect(err).To(Succeed())
+	Expect(out["content-type"]).To(HavePrefix("multipart/form-data; boundary="))
+	Expect(out["name"]).To(Equal("avatar"))
+	Expect(out["file"]).To(Equal("content"))
+
+	req, err = sdkhttp.NewRequest(context.Background(), "POST", srv.URL, sdkhttp.Body.WithJSON(make(chan int)))
+	Expect(err).To(HaveOccurred())
+	Expect(req).To(BeNil())
+
+	_, err = sdkhttp.NewRequest(context.Background(), "POST", srv.URL, "body")
+	Expect(err).To(MatchError(sdkhttp.ErrRequestOption))
+
+	_, err = sdkhttp.NewRequest(context.Background(), "POST", srv.URL,
+		sdkhttp.Body.WithString("a"), sdkhttp.MultipartForm.WithField("b", "c"))
+	Expect(err).To(MatchError(sdkhttp.ErrRequestOption))
+
+	broken := errors.New("broken reader")
+	req, err = sdkhttp.NewRequest(context.Background(), "POST", srv.URL,
+		sdkhttp.MultipartForm.File("file", "broken.txt", iotest.ErrReader(broken)))
+	Expect(err).To(Succeed())
+
+	_, err = do(req)
+	Expect(err).To(MatchError(broken))
+
+	_, err = sdkhttp.MultipartForm.Build(io.Discard,
+		sdkhttp.MultipartForm.Field("name", "avatar"),
+		sdkhttp.MultipartForm.File("file", "broken.txt", iotest.ErrReader(broken)))
+	Expect(err).To(MatchError(broken))
+}
+
+//nolint:funlen
+func testCompress(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	large := strings.Repeat(`{"name":"brock"},`, 100)
+	h := sdkhttp.Compress(&sdkhttp.CompressConfiguration{MinSize: 512, MaxDecompressedSize: 1 << 10},
+		sdkhttp.Mux().
+			Handle("GET", "/large", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(large))
+			})).
+			Handle("GET", "/small", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{}`))
+			})).
+			Handle("GET", "/image", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(large))
+			})).
+			Handle("GET", "/stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				wr := sdkhttp.Wrap.Handler(w, r)
+				_, _ = wr.Stream([]byte("a"))
+				_, _ = wr.Stream([]byte("b"))
+			})).
+			Handle("GET", "/push", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = io.WriteString(w, sdk.Sprint(errors.Is(w.(http.Pusher).Push("/a", nil), sdkhttp.ErrUnimplemented)))
+			})).
+			Handle("POST", "/echo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+
+					return
+				}
+				_, _ = w.Write(p)
+			})),
+	)
+
+	serve := func(method, target, acceptEncoding string, body io.Reader) *httptest.ResponseRecorder {
+		w, r := newMockHandler(method, target, body)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+
+		if body != nil {
+			r.Header.Set("Content-Encoding", "gzip")
+		}
+
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	gunzip := func(p []byte) string {
+		gz, err := gzip.NewReader(bytes.NewReader(p))
+		Expect(err).To(Succeed())
+
+		out, err := io.ReadAll(gz)
+		Expect(err).To(Succeed())
+
+		return string(out)
+	}
+
+	w := serve("GET", "/large", "gzip, deflate", nil)
+	Expect(w.Header().Get("Content-Encoding")).To(Equal("gzip"))
+	Expect(w.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+	Expect(w.Body.Len()).To(BeNumerically("<", len(large)))
+	Expect(gunzip(w.Body.Bytes())).To(Equal(large))
+
+	w = serve("GET", "/large", "gzip;q=0.5, deflate", nil)
+	Expect(w.Header().Get("Content-Encoding")).To(Equal("deflate"))
+
+	zr, err := zlib.NewReader(w.Body)
+	Expect(err).To(Succeed())
+
+	out, err := io.ReadAll(zr)
+	Expect(err).To(Succeed())
+	Expect(string(out)).To(Equal(large))
+
+	w = serve("GET", "/large", "identity", nil)
+	Expect(w.Header().Get("Content-Encoding")).To(BeEmpty())
+	Expect(w.Body.String()).To(Equal(large))
+
+	w = serve("GET", "/small", "gzip", nil)
+	Expect(w.Header().Get("Content-Encoding")).To(BeEmpty())
+	Expect(w.Body.String()).To(Equal(`{}`))
+
+	w = serve("GET", "/push", "gzip", nil)
+	Expect(w.Body.String()).To(Equal("true"))
+
+	w = serve("GET", "/image", "gzip", nil)
+	Expect(w.Header().Get("Content-Encoding")).To(BeEmpty())
+
+	w = serve("GET", "/stream", "gzip", nil)
+	Expect(w.Header().Get("Content-Encoding")).To(Equal("gzip"))
+	Expect(w.Flushed).To(BeTrue())
+	Expect(gunzip(w.Body.Bytes())).To(Equal("ab"))
+
+	compressed := new(bytes.Buffer)
+	gz := gzip.NewWriter(compressed)
+	_, _ = gz.Write([]byte("hello"))
+	_ = gz.Close()
+
+	w = serve("POST", "/echo", "", bytes.NewReader(compressed.Bytes()))
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Body.String()).To(Equal("hello"))
+
+	compressed.Reset()
+	gz = gzip.NewWriter(compressed)
+	_, _ = gz.Write(bytes.Repeat([]byte("a"), 2<<10))
+	_ = gz.Close()
+
+	w = serve("POST", "/echo", "", bytes.NewReader(compressed.Bytes()))
+	Expect(w.Code).To(Equal(http.StatusRequestEntityTooLarge))
+
+	w = serve("POST", "/echo", "", strings.NewReader("not gzip"))
+	Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+	// the deflate coding is the zlib format
+	compressed.Reset()
+	zw := zlib.NewWriter(compressed)
+	_, _ = zw.Write([]byte("hello"))
+	_ = zw.Close()
+
+	w, r := newMockHandler("POST", "/echo", bytes.NewReader(compressed.Bytes()))
+	r.Header.Set("Content-Encoding", "deflate")
+	h.ServeHTTP(w, r)
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Body.String()).To(Equal("hello"))
+}
+
+func testRateLimit(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })
+
+	serve := func(h http.Handler, target, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+		w, r := newMockHandler("GET", target, nil)
+		r.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			r.Header.Set("X-Api-Key", apiKey)
+		}
+
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	Expect(func() { sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{}, ok) }).To(Panic())
+
+	// token bucket by ip
+	h := sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{Limit: 2, Window: time.Hour}, ok)
+
+	w := serve(h, "/", "10.0.0.1:1234", "")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("RateLimit-Limit")).To(Equal("2"))
+	Expect(w.Header().Get("RateLimit-Remaining")).To(Equal("1"))
+	Expect(w.Header().Get("RateLimit-Reset")).To(Equal("1800"))
+
+	w = serve(h, "/", "10.0.0.1:5678", "")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+
+	w = serve(h, "/", "10.0.0.1:1234", "")
+	Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+	Expect(w.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+	Expect(w.Header().Get("Retry-After")).To(Equal("1800"))
+	Expect(w.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+
+	Expect(serve(h, "/", "10.0.0.2:1234", "").Code).To(Equal(http.StatusOK))
+
+	// sliding window by header, fallback to ip
+	h = sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{
+		Limit: 1, Window: time.Hour, Key: sdkhttp.RateLimitByHeader("X-Api-Key"),
+		Store: sdkhttp.RateLimitSlidingWindow(),
+	}, ok)
+
+	Expect(serve(h, "/", "10.0.0.1:1234", "a").Code).To(Equal(http.StatusOK))
+	Expect(serve(h, "/", "10.0.0.2:1234", "a").Code).To(Equal(http.StatusTooManyRequests))
+	Expect(serve(h, "/", "10.0.0.1:1234", "b").Code).To(Equal(http.StatusOK))
+	Expect(serve(h, "/", "10.0.0.1:1234", "").Code).To(Equal(http.StatusOK))
+	Expect(serve(h, "/", "10.0.0.1:1234", "").Code).To(Equal(http.StatusTooManyRequests))
+
+	// by named argument of the route
+	h = sdkhttp.Mux().Handle("GET", "/tenants/{tenant}", sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{
+		Limit: 1, Window: time.Hour, Key: sdkhttp.RateLimitByNamedArg("tenant"),
+	}, ok))
+
+	Expect(serve(h, "/tenants/a", "10.0.0.1:1234", "").Code).To(Equal(http.StatusOK))
+	Expect(serve(h, "/tenants/a", "10.0.0.2:1234", "").Code).To(Equal(http.StatusTooManyRequests))
+	Expect(serve(h, "/tenants/b", "10.0.0.1:1234", "").Code).To(Equal(http.StatusOK))
+
+	// sql store
+	db, mock, err := sqlmock.New()
+	Expect(err).To(Succeed())
+
+	defer db.Close()
+
+	h = sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{
+		Limit: 2, Window: time.Hour, Store: sdkhttp.RateLimitSQL(db, "rate_limits"),
+	}, ok)
+
+	mock.ExpectExec(`DELETE FROM rate_limits WHERE start < \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO rate_limits .* ON CONFLICT \(key, start\) DO UPDATE`).
+		WithArgs("ip:10.0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "prev"}).AddRow(1, 0))
+	mock.ExpectQuery(`INSERT INTO rate_limits`).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "prev"}).AddRow(3, 0))
+	mock.ExpectQuery(`INSERT INTO rate_limits`).WillReturnError(errors.New("connection refused"))
+
+	w = serve(h, "/", "10.0.0.1:1234", "")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("RateLimit-Remaining")).To(Equal("1"))
+
+	w = serve(h, "/", "10.0.0.1:1234", "")
+	Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+	Expect(w.Header().Get("Retry-After")).NotTo(BeEmpty())
+
+	// store error let the request through
+	w = serve(h, "/", "10.0.0.1:1234", "")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("RateLimit-Limit")).To(BeEmpty())
+
+	Expect(mock.ExpectationsWereMet()).To(Succeed())
+}
+
+func testCORS(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })
+	mux := sdkhttp.Mux().
+		Handle("GET", "/users/{id}", ok).
+		Handle("PUT", "/users/{id}", ok).
+		Handle("DELETE", "/users/{id}", ok)
+
+	serve := func(h http.Handler, method, target, origin string, header ...string) *httptest.ResponseRecorder {
+		w, r := newMockHandler(method, target, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	Expect(func() { sdkhttp.CORS(&sdkhttp.CORSConfiguration{AllowCredentials: true}, ok) }).To(Panic())
+	Expect(func() { sdkhttp.CORS(&sdkhttp.CORSConfiguration{AllowedOrigins: []string{"https://a*.com"}}, ok) }).To(Panic())
+
+	h := sdkhttp.CORS(&sdkhttp.CORSConfiguration{
+		AllowedOrigins:   []string{"https://*.example.com", "http://localhost:3000"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}, mux)
+
+	w := serve(h, "OPTIONS", "/users/1", "https://app.example.com",
+		"Access-Control-Request-Method", "PUT", "Access-Control-Request-Headers", "Content-Type")
+	Expect(w.Code).To(Equal(http.StatusNoContent))
+	Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://app.example.com"))
+	Expect(w.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+	Expect(w.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET, HEAD, PUT, DELETE, OPTIONS"))
+	Expect(w.Header().Get("Access-Control-Allow-Headers")).To(Equal("Content-Type"))
+	Expect(w.Header().Get("Access-Control-Max-Age")).To(Equal("3600"))
+	Expect(w.Header().Values("Vary")).To(ContainElements("Origin", "Access-Control-Request-Method"))
+
+	w = serve(h, "GET", "/users/1", "http://localhost:3000")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("http://localhost:3000"))
+	Expect(w.Header().Get("Access-Control-Expose-Headers")).To(Equal("X-Total"))
+
+	// not allowed origin, the apex domain is not matched by the wildcard
+	for _, origin := range []string{"https://example.com", "https://evil.com", "http://app.example.com"} {
+		w = serve(h, "GET", "/users/1", origin)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	}
+
+	// the unmatched path is handled by the mux
+	w = serve(h, "OPTIONS", "/unknown", "https://app.example.com", "Access-Control-Request-Method", "GET")
+	Expect(w.Code).To(Equal(http.StatusNotFound))
+	Expect(w.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+
+	// the plain OPTIONS is handled by the mux
+	w = serve(h, "OPTIONS", "/users/1", "https://app.example.com")
+	Expect(w.Code).To(Equal(http.StatusNoContent))
+	Expect(w.Header().Get("Allow")).To(Equal("GET, HEAD, PUT, DELETE, OPTIONS"))
+
+	h = sdkhttp.CORS(&sdkhttp.CORSConfiguration{
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization"},
+	}, mux)
+
+	w = serve(h, "OPTIONS", "/users/1", "https://any.com", "Access-Control-Request-Method", "GET")
+	Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("*"))
+	Expect(w.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET"))
+	Expect(w.Header().Get("Access-Control-Allow-Headers")).To(Equal("Authorization"))
+	Expect(w.Header().Get("Access-Control-Max-Age")).To(BeEmpty())
+
+	w = serve(sdkhttp.CORS(nil, ok), "OPTIONS", "/", "https://any.com", "Access-Control-Request-Method", "GET")
+	Expect(w.Code).To(Equal(http.StatusNoContent))
+	Expect(w.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET, HEAD, POST"))
+}
+
+func testServe(t *testing.T) {
+	t.Parallel()
+	Expect, Eventually := NewWithT(t).Expect, NewWithT(t).Eventually
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+
+	base := "http://" + ln.Addr().String()
+	started, release := make(chan struct{}), make(chan struct{})
+	hooks := make([]string, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sdkhttp.Serve(ctx, &sdkhttp.ServeConfiguration{
+			Listener:      ln,
+			ShutdownDelay: 200 * time.Millisecond,
+			OnShutdown: []func(context.Context) error{
+				func(context.Context) error { hooks = append(hooks, "tracer"); return nil },
+				func(context.Context) error { hooks = append(hooks, "sql"); return errors.New("sql: closed") },
+			},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = w.Write([]byte("drained"))
+		}))
+	}()
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(base + path) //nolint:noctx
+		if err != nil {
+			return 0, err.Error()
+		}
+
+		defer res.Body.Close()
+		p, _ := io.ReadAll(res.Body)
+
+		return res.StatusCode, string(p)
+	}
+
+	code := func(path string) int { c, _ := get(path); return c }
+
+	Eventually(func() int { return code("/healthz") }).Should(Equal(http.StatusOK))
+	Expect(code("/readyz")).To(Equal(http.StatusOK))
+
+	inflight := make(chan string, 1)
+	go func() { _, body := get("/slow"); inflight <- body }()
+	<-started
+
+	cancel()
+	Eventually(func() int { return code("/readyz") }).Should(Equal(http.StatusServiceUnavailable))
+	Expect(code("/healthz")).To(Equal(http.StatusOK))
+
+	close(release)
+	Expect(<-inflight).To(Equal("drained"))
+
+	err = <-done
+	Expect(err).To(MatchError(ContainSubstring("sql: closed")))
+	Expect(hooks).To(Equal([]string{"tracer", "sql"}))
+
+	Expect(code("/healthz")).To(BeZero())
+
+	// the disabled endpoint is passed to the handler
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+
+	base = "http://" + ln.Addr().String()
+	ctx, cancel = context.WithCancel(context.Background())
+
+	go func() {
+		done <- sdkhttp.Serve(ctx, &sdkhttp.ServeConfiguration{Listener: ln, LivenessPath: "-"},
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, r.URL.Path, http.StatusTeapot)
+			}))
+	}()
+
+	Eventually(func() int { return code("/readyz") }).Should(Equal(http.StatusOK))
+	Expect(code("/healthz")).To(Equal(http.StatusTeapot))
+
+	cancel()
+	Expect(<-done).To(Succeed())
+}
+
+func testETag(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	modified := time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+	h := sdkhttp.ETag(&sdkhttp.ETagConfiguration{MaxSize: 64},
+		sdkhttp.Mux().
+			Handle("GET", "/hashed", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = sdkhttp.Wrap.Handler(w, r).Render(http.StatusOK, map[string]string{"name": "brock"})
+			})).
+			Handle("GET", "/large", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(bytes.Repeat([]byte("a"), 128))
+			})).
+			Handle("GET,PUT", "/supplied", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				wr := sdkhttp.Wrap.Handler(w, r)
+				if wr.Precondition("v2", modified) {
+					return
+				}
+
+				_, _ = wr.Send(http.StatusOK, nil, strings.NewReader(r.Method))
+			})),
+	)
+
+	serve := func(method, target string, header ...string) *httptest.ResponseRecorder {
+		w, r := newMockHandler(method, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := serve("GET", "/hashed")
+	etag := w.Header().Get("ETag")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(etag).To(MatchRegexp(`^"[A-Za-z0-9_-]{22}"$`))
+	Expect(w.Body.String()).To(Equal(`{"name":"brock"}`))
+
+	w = serve("GET", "/hashed", "If-None-Match", `"other", W/`+etag)
+	Expect(w.Code).To(Equal(http.StatusNotModified))
+	Expect(w.Header().Get("ETag")).To(Equal(etag))
+	Expect(w.Header().Get("Content-Type")).To(BeEmpty())
+	Expect(w.Body.Len()).To(BeZero())
+
+	// the HEAD has the same validators as the GET
+	w = serve("HEAD", "/hashed")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("ETag")).To(Equal(etag))
+	Expect(w.Body.Len()).To(BeZero())
+
+	w = serve("HEAD", "/hashed", "If-None-Match", etag)
+	Expect(w.Code).To(Equal(http.StatusNotModified))
+	Expect(w.Header().Get("ETag")).To(Equal(etag))
+
+	w = serve("GET", "/hashed", "If-Match", `"other"`)
+	Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+	Expect(w.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+
+	w = serve("GET", "/large", "If-None-Match", "*")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("ETag")).To(BeEmpty())
+	Expect(w.Body.Len()).To(Equal(128))
+
+	w = serve("GET", "/supplied")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("ETag")).To(Equal(`"v2"`))
+	Expect(w.Header().Get("Last-Modified")).To(Equal("Mon, 01 Aug 2022 10:00:00 GMT"))
+
+	w = serve("GET", "/supplied", "If-Modified-Since", modified.Format(http.TimeFormat))
+	Expect(w.Code).To(Equal(http.StatusNotModified))
+
+	w = serve("GET", "/supplied", "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat))
+	Expect(w.Code).To(Equal(http.StatusOK))
+
+	// If-None-Match takes precedence over If-Modified-Since
+	w = serve("GET", "/supplied", "If-None-Match", `"v1"`, "If-Modified-Since", modified.Format(http.TimeFormat))
+	Expect(w.Code).To(Equal(http.StatusOK))
+
+	w = serve("PUT", "/supplied", "If-Match", `"v1"`)
+	Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+	Expect(w.Body.String()).To(ContainSubstring(`"status":412`))
+
+	w = serve("PUT", "/supplied", "If-Match", `"v2"`)
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Body.String()).To(Equal("PUT"))
+
+	w = serve("PUT", "/supplied", "If-Match", `W/"v2"`)
+	Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+
+	w = serve("PUT", "/supplied", "If-Unmodified-Since", modified.Add(-time.Hour).Format(http.TimeFormat))
+	Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+
+	w = serve("PUT", "/supplied", "If-None-Match", "*")
+	Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+}
+
+func testRequestID(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get(sdkhttp.HeaderRequestID)))
+	}))
+	defer upstream.Close()
+
+	logs := new(bytes.Buffer)
+	h := sdkhttp.RequestID(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sdkotel.Log(r.Context()).Info().Msg("handled")
+
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL, nil)
+		res, err := sdkhttp.Client().Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+
+			return
+		}
+
+		p, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		_, _ = w.Write([]byte(sdkotel.RequestIDFromContext(r.Context()) + "=" + string(p)))
+	}))
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		w, r := newMockHandler("GET", "/", nil)
+		if id != "" {
+			r.Header.Set(sdkhttp.HeaderRequestID, id)
+		}
+
+		r = r.WithContext(sdkotel.Log(r.Context(), logs).Context(r.Context()))
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := serve("")
+	id := w.Header().Get(sdkhttp.HeaderRequestID)
+	Expect(id).To(MatchRegexp(`^[0-9a-v]{20}$`))
+	Expect(w.Body.String()).To(Equal(id + "=" + id))
+	Expect(logs.String()).To(ContainSubstring(`"request_id":"` + id + `"`))
+
+	w = serve("abc-123")
+	Expect(w.Header().Get(sdkhttp.HeaderRequestID)).To(Equal("abc-123"))
+	Expect(w.Body.String()).To(Equal("abc-123=abc-123"))
+
+	w = serve("bad id\x00")
+	Expect(w.Header().Get(sdkhttp.HeaderRequestID)).To(MatchRegexp(`^[0-9a-v]{20}$`))
+
+	Expect(sdkotel.RequestIDFromContext(context.Background())).To(BeEmpty())
+}
+
+func testIdempotency(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	calls, started, release := int32(0), make(chan struct{}), make(chan struct{})
+	h := sdkhttp.Idempotency(nil, sdkhttp.Mux().
+		Handle("POST", "/payments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := io.ReadAll(r.Body)
+			n := atomic.AddInt32(&calls, 1)
+			w.Header().Set("Location", "/payments/"+sdk.Sprint(n))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(p)
+		})).
+		Handle("POST", "/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		})).
+		Handle("POST", "/fail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		})),
+	)
+
+	serve := func(target, key, body string) *httptest.ResponseRecorder {
+		w, r := newMockHandler("POST", target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := serve("/payments", "k1", `{"amount":10}`)
+	Expect(w.Code).To(Equal(http.StatusCreated))
+	Expect(w.Header().Get("Location")).To(Equal("/payments/1"))
+	Expect(w.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+
+	w = serve("/payments", "k1", `{"amount":10}`)
+	Expect(w.Code).To(Equal(http.StatusCreated))
+	Expect(w.Header().Get("Location")).To(Equal("/payments/1"))
+	Expect(w.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+	Expect(w.Body.String()).To(Equal(`{"amount":10}`))
+	Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(1))
+
+	w = serve("/payments", "k1", `{"amount":99}`)
+	Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+	Expect(w.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+
+	Expect(serve("/payments", "", `{"amount":10}`).Code).To(Equal(http.StatusCreated))
+	Expect(serve("/payments", "", `{"amount":10}`).Header().Get("Location")).To(Equal("/payments/3"))
+
+	// 5xx is not stored
+	Expect(serve("/fail", "k2", "").Code).To(Equal(http.StatusServiceUnavailable))
+	Expect(serve("/fail", "k2", "").Code).To(Equal(http.StatusServiceUnavailable))
+	Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(5))
+
+	done := make(chan int, 1)
+	go func() { done <- serve("/slow", "k3", "").Code }()
+	<-started
+
+	w = serve("/slow", "k3", "")
+	Expect(w.Code).To(Equal(http.StatusConflict))
+	Expect(w.Header().Get("Retry-After")).To(Equal("1"))
+
+	close(release)
+	Expect(<-done).To(Equal(http.StatusOK))
+	Expect(serve("/slow", "k3", "").Header().Get("Idempotent-Replayed")).To(Equal("true"))
+
+	// sql store
+	db, mock, err := sqlmock.New()
+	Expect(err).To(Succeed())
+
+	defer db.Close()
+
+	h = sdkhttp.Idempotency(&sdkhttp.IdempotencyConfiguration{
+		Store: sdkhttp.IdempotencySQL(db, "idempotency_keys"),
+		Scope: func(r *http.Request) string { return "user1" },
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("paid"))
+	}))
+
+	mock.ExpectQuery(`INSERT INTO idempotency_keys .* ON CONFLICT \(key\) DO UPDATE .* RETURNING key`).
+		WithArgs("user1:k1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("user1:k1"))
+	mock.ExpectExec(`UPDATE idempotency_keys SET status = \$2, header = \$3, body = \$4, expires = \$5 WHERE key = \$1`).
+		WithArgs("user1:k1", http.StatusOK, `{"Content-Type":["text/plain"]}`, []byte("paid"), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w = serve("/", "k1", "")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Body.String()).To(Equal("paid"))
+
+	mock.ExpectQuery(`INSERT INTO idempotency_keys`).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+	mock.ExpectQuery(`SELECT fingerprint, status, header, body FROM idempotency_keys WHERE key = \$1`).
+		WithArgs("user1:k1").
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "header", "body"}).
+			AddRow("other", 200, `{}`, []byte{}))
+
+	w = serve("/", "k1", "")
+	Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+
+	sum := sha256.Sum256([]byte("POST /\n"))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	mock.ExpectQuery(`INSERT INTO idempotency_keys`).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+	mock.ExpectQuery(`SELECT fingerprint`).
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "header", "body"}).
+			AddRow(fingerprint, 200, `{"Content-Type":["text/plain"]}`, []byte("paid")))
+
+	w = serve("/", "k1", "")
+	Expect(w.Code).To(Equal(http.StatusOK))
+	Expect(w.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+	Expect(w.Body.String()).To(Equal("paid"))
+
+	mock.ExpectQuery(`INSERT INTO idempotency_keys`).WillReturnError(errors.New("connection refused"))
+
+	w = serve("/", "k1", "")
+	Expect(w.Code).To(Equal(http.StatusInternalServerError))
+
+	Expect(mock.ExpectationsWereMet()).To(Succeed())
+}
+
 func newMockHandler(method, target string, body io.Reader) (*httptest.ResponseRecorder, *http.Request) {
 	return httptest.NewRecorder(), httptest.NewRequest(method, target, body)
 }
@@ -0,0 +1,337 @@
+package sdkhttp
+
+import (
+	"encoding"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+var (
+	ErrBindTarget           = sdk.Errorf("brock/sdkhttp: bind target must be a non-nil pointer")
+	ErrUnsupportedMediaType = sdk.Errorf("brock/sdkhttp: unsupported media type")
+)
+
+// BindMaxMemory is the maximum bytes of the multipart form kept in memory
+// when binding, the rest is stored in temporary files.
+const BindMaxMemory = 32 << 20
+
+// BindError is the error of the field that failed to bind.
+type BindError struct {
+	// Field is the dotted path of the Go struct field, e.g. Address.City
+	Field string
+	// Source is where the value come from: body, query, header, path or form
+	Source string
+	// Key is the name of the value in the Source
+	Key string
+	Err error
+}
+
+func (err *BindError) Error() string {
+	return "brock/sdkhttp: bind " + err.Source + " " + strconv.Quote(err.Key) + " into " + err.Field + ": " +
+		err.Err.Error()
+}
+
+func (err *BindError) Unwrap() error { return err.Err }
+
+// Bind decode the body based on the Content-Type into dst then fill the
+// struct fields tagged with `query:"name"`, `header:"Name"`, `path:"name"`
+// and `form:"name"`, the tagged value that is absent in the request leave the
+// field untouched, then dst is validated using sdk.Validate. The error is
+// either ErrBindTarget, ErrUnsupportedMediaType, sdk.ErrValidationRule,
+// sdk.Errors of *BindError or sdk.Errors of *sdk.FieldError.
+//
+//	var in struct {
+//		ID    int64    `path:"id"`
+//		Page  int      `query:"page"`
+//		Token string   `header:"Authorization"`
+//		Name  string   `json:"name" form:"name"`
+//		Tags  []string `query:"tag"`
+//	}
+//	err := sdkhttp.Bind(r, &in)
+func Bind(r *http.Request, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return ErrBindTarget
+	}
+
+	var form url.Values
+
+	var files map[string][]*multipart.FileHeader
+
+	errs := make(sdk.Errors, 0)
+
+	switch mediaType := bindMediaType(r); {
+	case mediaType == "" && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0):
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			errs = append(errs, &BindError{Source: "body", Err: err})
+		}
+
+		form = r.PostForm
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(BindMaxMemory); err != nil {
+			errs = append(errs, &BindError{Source: "body", Err: err})
+		} else {
+			form, files = r.MultipartForm.Value, r.MultipartForm.File
+		}
+	default:
+		parser := bindParser(mediaType)
+		if parser == nil {
+			return sdk.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+		}
+
+		if err := parser.NewDecoder(r.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+			errs = append(errs, &BindError{Source: "body", Err: err})
+		}
+	}
+
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		sources := map[string]func(key string) ([]string, bool){
+			"path":  bindValues(NamedArgsFromRequest(r)),
+			"query": bindValues(r.URL.Query()),
+			"header": func(key string) ([]string, bool) {
+				s := r.Header.Values(key)
+
+				return s, len(s) > 0
+			},
+			"form": bindValues(form),
+		}
+		errs = append(errs, bindStruct(v, "", sources, files)...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return sdk.Validate(dst)
+}
+
+// Bind the request into dst just like the Bind function, on failure the
+// error is sent as the 415, 400 or 422 when sdk.ErrValidation problem with
+// the invalid fields in its errors member, then passed to the next handler.
+//
+//	var in input
+//	if err := sdkhttp.Wrap.Handler(w, r).Bind(&in); err != nil {
+//		return
+//	}
+func (x *handler) Bind(dst any) error {
+	err := Bind(x.r, dst)
+	if err == nil {
+		return nil
+	}
+
+	code := http.StatusBadRequest
+
+	switch {
+	case errors.Is(err, ErrBindTarget), errors.Is(err, sdk.ErrValidationRule):
+		code = http.StatusInternalServerError
+	case errors.Is(err, ErrUnsupportedMediaType):
+		code = http.StatusUnsupportedMediaType
+	case errors.Is(err, sdk.ErrValidation):
+		code = http.StatusUnprocessableEntity
+	}
+
+	_, _ = x.Problem(&StatusError{Code: code, Err: err})
+	x.Next(err)
+
+	return err
+}
+
+func bindMediaType(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return strings.ToLower(mediaType)
+}
+
+func bindParser(mediaType string) sdk.Parser {
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return sdk.JSON
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		return sdk.XML
+	case mediaType == "application/yaml", mediaType == "application/x-yaml", mediaType == "text/yaml":
+		return sdk.YAML
+	case mediaType == "application/toml":
+		return sdk.TOML
+	}
+
+	return nil
+}
+
+func bindValues(values url.Values) func(key string) ([]string, bool) {
+	return func(key string) ([]string, bool) {
+		s, ok := values[key]
+
+		return s, ok
+	}
+}
+
+//nolint:gochecknoglobals
+var (
+	bindTags       = []string{"path", "query", "header", "form"}
+	bindFileHeader = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+func bindStruct(
+	v reflect.Value,
+	prefix string,
+	sources map[string]func(string) ([]string, bool),
+	files map[string][]*multipart.FileHeader,
+) sdk.Errors {
+	errs := make(sdk.Errors, 0)
+
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		field, tagged := prefix+f.Name, false
+
+		for _, source := range bindTags {
+			key, ok := f.Tag.Lookup(source)
+			if key, _, _ = strings.Cut(key, ","); !ok || key == "-" {
+				continue
+			}
+
+			tagged = true
+
+			if source == "form" && bindFile(fv, files[key]) {
+				continue
+			}
+
+			values, ok := sources[source](key)
+			if !ok {
+				continue
+			}
+
+			if err := bindValue(fv, values); err != nil {
+				errs = append(errs, &BindError{Field: field, Source: source, Key: key, Err: err})
+			}
+		}
+
+		if t := f.Type; !tagged && t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}) {
+			errs = append(errs, bindStruct(fv, sdk.IfThenElse(f.Anonymous, prefix, field+"."), sources, files)...)
+		}
+	}
+
+	return errs
+}
+
+// bindFile set the *multipart.FileHeader or []*multipart.FileHeader field.
+func bindFile(v reflect.Value, files []*multipart.FileHeader) bool {
+	switch {
+	case v.Type() == bindFileHeader:
+		if len(files) > 0 {
+			v.Set(reflect.ValueOf(files[0]))
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem() == bindFileHeader:
+		if len(files) > 0 {
+			v.Set(reflect.ValueOf(files))
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+func bindValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i := range values {
+			if err := bindScalar(s.Index(i), values[i]); err != nil {
+				return err
+			}
+		}
+
+		v.Set(s)
+
+		return nil
+	}
+
+	if len(values) < 1 {
+		return nil
+	}
+
+	return bindScalar(v, values[0])
+}
+
+//nolint:cyclop
+func bindScalar(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return bindScalar(v.Elem(), s)
+	}
+
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	default:
+		return sdk.Errorf("unsupported type %s", v.Type())
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice: // []byte
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+
+			v.SetInt(int64(d))
+
+			return nil
+		}
+
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(n)
+	}
+
+	return nil
+}
@@ -35,8 +35,26 @@ func (body) WithString(v string) func() io.Reader {
 func (body) WithJSON(v any) func() io.Reader {
 	return func() io.Reader {
 		buf := new(bytes.Buffer)
-		_ = sdk.JSON.NewEncoder(buf).Encode(v)
+		err := sdk.JSON.NewEncoder(buf).Encode(v)
 
-		return buf
+		return &bodyReader{buf, "application/json", err}
 	}
 }
+
+// bodyReader carry the content type of the body and the error while
+// creating it, the error is returned on Read.
+type bodyReader struct {
+	io.Reader
+	contentType string
+	err         error
+}
+
+func (x *bodyReader) Read(p []byte) (int, error) {
+	if x.err != nil {
+		return 0, x.err
+	}
+
+	return x.Reader.Read(p)
+}
+
+func (x *bodyReader) ContentType() string { return x.contentType }
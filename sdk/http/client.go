@@ -0,0 +1,265 @@
+package sdkhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+)
+
+// ClientConfiguration of the Client, the zero value is usable.
+type ClientConfiguration struct {
+	// Timeout of the whole request including the retries, 0 means no timeout
+	Timeout time.Duration
+	// DialTimeout default to 30 seconds
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout default to 10 seconds
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout of each attempt, 0 means no timeout
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout default to 90 seconds
+	IdleConnTimeout time.Duration
+
+	// MaxConnsPerHost limits the dialing, active and idle connections per
+	// host, 0 means no limit
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost default to http.DefaultMaxIdleConnsPerHost
+	MaxIdleConnsPerHost int
+
+	// MaxRetries of the idempotent request, 0 means no retry
+	MaxRetries int
+	// RetryWaitMin is the base of the exponential backoff, default to 100ms
+	RetryWaitMin time.Duration
+	// RetryWaitMax caps the backoff, the Retry-After longer than it is not
+	// retried, default to 10 seconds
+	RetryWaitMax time.Duration
+
+	// Tracer start the client span of each attempt, when nil the span in the
+	// request context is propagated as is.
+	Tracer *sdkotel.Tracer
+	// Transport replace the default transport, the connection settings above
+	// are ignored.
+	Transport http.RoundTripper
+}
+
+// Client create the http.Client that retries the idempotent request with the
+// exponential backoff & jitter and injects the W3C trace context and the
+// request ID.
+//
+//	c := sdkhttp.Client(&sdkhttp.ClientConfiguration{Timeout: 10 * time.Second, MaxRetries: 3})
+//	res, err := c.Do(req)
+//	if err == nil {
+//		err = sdkhttp.Decode(res, &out)
+//	}
+func Client(c ...*ClientConfiguration) *http.Client {
+	c0 := new(ClientConfiguration)
+	if len(c) > 0 && c[0] != nil {
+		c0 = c[0]
+	}
+
+	base := c0.Transport
+	if base == nil {
+		dialer := &net.Dialer{
+			Timeout:   sdk.IfThenElse(c0.DialTimeout > 0, c0.DialTimeout, 30*time.Second),
+			KeepAlive: 30 * time.Second,
+		}
+		base = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxConnsPerHost:       c0.MaxConnsPerHost,
+			MaxIdleConnsPerHost:   c0.MaxIdleConnsPerHost,
+			IdleConnTimeout:       sdk.IfThenElse(c0.IdleConnTimeout > 0, c0.IdleConnTimeout, 90*time.Second),
+			TLSHandshakeTimeout:   sdk.IfThenElse(c0.TLSHandshakeTimeout > 0, c0.TLSHandshakeTimeout, 10*time.Second),
+			ResponseHeaderTimeout: c0.ResponseHeaderTimeout,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+	}
+
+	return &http.Client{
+		Timeout: c0.Timeout,
+		Transport: &clientTransport{
+			base:       base,
+			tracer:     c0.Tracer,
+			maxRetries: c0.MaxRetries,
+			waitMin:    sdk.IfThenElse(c0.RetryWaitMin > 0, c0.RetryWaitMin, 100*time.Millisecond),
+			waitMax:    sdk.IfThenElse(c0.RetryWaitMax > 0, c0.RetryWaitMax, 10*time.Second),
+		},
+	}
+}
+
+// Decode the 2xx response body into v using the sdk.Parser based on the
+// Content-Type, default to JSON. The other status is returned as
+// *StatusError with the beginning of the body as the message. The body is
+// always closed.
+func Decode(res *http.Response, v any) error {
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		p, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return &StatusError{Code: res.StatusCode, Err: sdk.Errorf("brock/sdkhttp: %s: %s", res.Status, p)}
+	}
+
+	mediaType := bindMediaType(&http.Request{Header: res.Header})
+
+	parser := sdk.IfThenElse(mediaType == "", sdk.JSON, bindParser(mediaType))
+	if parser == nil {
+		return sdk.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+
+	if err := parser.NewDecoder(res.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+type clientTransport struct {
+	base       http.RoundTripper
+	tracer     *sdkotel.Tracer
+	maxRetries int
+	waitMin    time.Duration
+	waitMax    time.Duration
+}
+
+func (x *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retry := x.maxRetries > 0 && clientIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 0; ; attempt++ {
+		res, err := x.roundTrip(req, attempt)
+		if !retry || attempt >= x.maxRetries || !clientRetryable(req.Context(), res, err) {
+			return res, err
+		}
+
+		wait := x.backoff(attempt, res)
+		if wait < 0 {
+			return res, err
+		}
+
+		if res != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+			_ = res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip send a single attempt with the trace context injected into the
+// cloned request, the body is rewound from GetBody on the retry.
+func (x *clientTransport) roundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	ctx := req.Context()
+
+	var span trace.Span
+	if x.tracer != nil && x.tracer.Tracer != nil {
+		ctx, span = x.tracer.Start(ctx, "HTTP "+req.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(sdkotel.Attr.KeyValueHTTPClientRequest(req)...),
+			trace.WithAttributes(sdkotel.Attr.Key("http.retry_count").Int(attempt)),
+		)
+		defer span.End()
+	}
+
+	r := req.Clone(ctx)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	if id := sdkotel.RequestIDFromContext(ctx); id != "" && r.Header.Get(HeaderRequestID) == "" {
+		r.Header.Set(HeaderRequestID, id)
+	}
+
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		r.Body = body
+	}
+
+	res, err := x.base.RoundTrip(r)
+
+	if span != nil {
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(sdkotel.Code.StatusError(), err.Error())
+		default:
+			span.SetAttributes(sdkotel.Attr.KeyValueHTTPResponse(res.StatusCode, res.ContentLength)...)
+			if res.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(sdkotel.Code.StatusError(), res.Status)
+			}
+		}
+	}
+
+	return res, err
+}
+
+// backoff return the Retry-After or the exponential backoff with jitter, it
+// return negative when the Retry-After is longer than the waitMax.
+func (x *clientTransport) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if s := res.Header.Get("Retry-After"); s != "" {
+			var wait time.Duration
+			if n, err := strconv.Atoi(s); err == nil {
+				wait = time.Duration(n) * time.Second
+			} else if t, err := http.ParseTime(s); err == nil {
+				wait = time.Until(t)
+			}
+
+			return sdk.IfThenElse(wait > x.waitMax, -1, sdk.IfThenElse(wait < 0, 0, wait))
+		}
+	}
+
+	wait := x.waitMin << attempt
+	if wait > x.waitMax || wait <= 0 {
+		wait = x.waitMax
+	}
+
+	// equal jitter, keep the half and randomize the rest
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1)) //nolint:gosec
+}
+
+// clientIdempotent as in RFC 7231 section 4.2.2 or has the Idempotency-Key.
+func clientIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func clientRetryable(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	} else if err != nil {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,345 @@
+package sdkhttp
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+// CompressConfiguration of the Compress.
+type CompressConfiguration struct {
+	// Level of the compression from gzip.HuffmanOnly to gzip.BestCompression,
+	// default to gzip.DefaultCompression
+	Level int
+	// MinSize is the minimum bytes of the response to be compressed, the
+	// flushed response is always compressed, default to 1 KiB
+	MinSize int
+	// ContentTypes that are compressible, the type/* is allowed, default to
+	// text/*, JSON, XML, YAML, TOML, JavaScript and SVG
+	ContentTypes []string
+	// MaxDecompressedSize of the request body, default to 10 MiB
+	MaxDecompressedSize int64
+}
+
+//nolint:gochecknoglobals
+var compressContentTypes = []string{
+	"text/*",
+	"application/json", "application/*+json",
+	"application/xml", "application/*+xml",
+	"application/yaml", "application/x-yaml", "application/toml",
+	"application/javascript", "image/svg+xml",
+}
+
+// Compress the response with gzip or deflate negotiated from the
+// Accept-Encoding, and decompress the request body with the Content-Encoding
+// gzip or deflate up to the MaxDecompressedSize.
+//
+//	http.Server{Handler: sdkhttp.Compress(nil, mux)}
+func Compress(c *CompressConfiguration, h http.Handler) http.Handler {
+	c0 := CompressConfiguration{Level: gzip.DefaultCompression, MinSize: 1 << 10, MaxDecompressedSize: 10 << 20}
+	if c != nil {
+		c0.ContentTypes = c.ContentTypes
+
+		if c.Level != 0 {
+			c0.Level = c.Level
+		}
+
+		if c.MinSize > 0 {
+			c0.MinSize = c.MinSize
+		}
+
+		if c.MaxDecompressedSize > 0 {
+			c0.MaxDecompressedSize = c.MaxDecompressedSize
+		}
+	}
+
+	if len(c0.ContentTypes) < 1 {
+		c0.ContentTypes = compressContentTypes
+	}
+
+	if _, err := gzip.NewWriterLevel(io.Discard, c0.Level); err != nil {
+		panic("compress: " + err.Error())
+	}
+
+	gzipPool := &sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, c0.Level)
+
+		return w
+	}}
+	zlibPool := &sync.Pool{New: func() any {
+		w, _ := zlib.NewWriterLevel(io.Discard, c0.Level)
+
+		return w
+	}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := decompress(w, r, c0.MaxDecompressedSize); err != nil {
+			code := http.StatusBadRequest
+			http.Error(w, http.StatusText(code), code)
+
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := compressEncoding(r.Header.Values("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		pool := sdk.IfThenElse(encoding == "gzip", gzipPool, zlibPool)
+		cw := &compressWriter{responseWriter: responseWriter{ResponseWriter: w}, cfg: &c0, encoding: encoding, pool: pool}
+		defer cw.Close()
+
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// decompress replace the request body with the decompressed one.
+func decompress(w http.ResponseWriter, r *http.Request, limit int64) error {
+	var body io.ReadCloser
+
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	default:
+		return nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+
+		body = gz
+	case "deflate":
+		// the deflate coding is the zlib format, see RFC 9110 section 8.4.1.2
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+
+		body = zr
+	}
+
+	r.Body = http.MaxBytesReader(w, compressReadCloser{body, r.Body}, limit)
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+
+	return nil
+}
+
+type compressReadCloser struct {
+	io.ReadCloser
+	origin io.Closer
+}
+
+func (x compressReadCloser) Close() error {
+	_ = x.ReadCloser.Close()
+
+	return x.origin.Close()
+}
+
+// compressEncoding pick gzip over deflate unless it has the lower q.
+func compressEncoding(accepts []string) string {
+	q := map[string]float64{"gzip": -1, "deflate": -1}
+
+	for _, accept := range accepts {
+		for _, s := range strings.Split(accept, ",") {
+			coding, param, _ := strings.Cut(strings.TrimSpace(s), ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+
+			v := 1.0
+			if k, val, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(k) == "q" {
+				v, _ = strconv.ParseFloat(strings.TrimSpace(val), 64)
+			}
+
+			switch coding {
+			case "gzip", "x-gzip":
+				q["gzip"] = v
+			case "deflate":
+				q["deflate"] = v
+			case "*":
+				for k := range q {
+					if q[k] < 0 {
+						q[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	switch {
+	case q["gzip"] > 0 && q["gzip"] >= q["deflate"]:
+		return "gzip"
+	case q["deflate"] > 0:
+		return "deflate"
+	}
+
+	return ""
+}
+
+// compressor is either the *gzip.Writer or the *zlib.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter buffer the response up to the MinSize before deciding
+// whether it's compressed.
+type compressWriter struct {
+	responseWriter
+	cfg      *CompressConfiguration
+	encoding string
+	pool     *sync.Pool
+
+	code    int
+	buf     []byte
+	decided bool
+	w       io.Writer
+	cw      compressor
+}
+
+func (x *compressWriter) WriteHeader(statusCode int) {
+	if statusCode < http.StatusOK {
+		x.responseWriter.WriteHeader(statusCode)
+
+		return
+	} else if x.code != 0 {
+		return
+	}
+
+	x.code = statusCode
+
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		_ = x.decide(false)
+	}
+}
+
+func (x *compressWriter) Write(p []byte) (int, error) {
+	if x.code == 0 {
+		x.code = http.StatusOK
+	}
+
+	if x.decided {
+		return x.w.Write(p)
+	}
+
+	x.buf = append(x.buf, p...)
+	if len(x.buf) >= x.cfg.MinSize {
+		if err := x.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush decide the compression of the buffered response then flush both the
+// compressor and the http.ResponseWriter, used by WrapHandler.Stream.
+func (x *compressWriter) Flush() {
+	if x.code == 0 {
+		x.code = http.StatusOK
+	}
+
+	if !x.decided {
+		_ = x.decide(true)
+	}
+
+	if x.cw != nil {
+		_ = x.cw.Flush()
+	}
+
+	x.responseWriter.Flush()
+}
+
+// Close write the remaining buffer and close the compressor.
+func (x *compressWriter) Close() {
+	if !x.decided {
+		if x.code == 0 && len(x.buf) < 1 {
+			return
+		}
+
+		_ = x.decide(false)
+	}
+
+	if x.cw != nil {
+		_ = x.cw.Close()
+		x.pool.Put(x.cw)
+	}
+}
+
+func (x *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := x.responseWriter.Hijack()
+	if err == nil {
+		x.decided, x.w = true, &x.responseWriter
+	}
+
+	return conn, rw, err
+}
+
+// decide to compress when the content type is compressible and either the
+// buffer reach the MinSize or the response is flushed.
+func (x *compressWriter) decide(eligible bool) error {
+	x.decided = true
+	header := x.Header()
+
+	if header.Get("Content-Type") == "" && len(x.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(x.buf))
+	}
+
+	x.w = &x.responseWriter
+
+	if eligible && header.Get("Content-Encoding") == "" && x.compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", x.encoding)
+		header.Del("Content-Length")
+
+		x.cw, _ = x.pool.Get().(compressor)
+		x.cw.Reset(&x.responseWriter)
+		x.w = x.cw
+	}
+
+	x.responseWriter.WriteHeader(x.code)
+
+	if len(x.buf) < 1 {
+		return nil
+	}
+
+	_, err := x.w.Write(x.buf)
+	x.buf = nil
+
+	return err
+}
+
+func (x *compressWriter) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	for _, allowed := range x.cfg.ContentTypes {
+		t, s, _ := strings.Cut(allowed, "/")
+
+		switch {
+		case t != typ && t != "*":
+		case s == subtype, s == "*":
+			return true
+		case strings.HasPrefix(s, "*+") && strings.HasSuffix(subtype, s[1:]):
+			return true
+		}
+	}
+
+	return false
+}
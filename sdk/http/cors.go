@@ -0,0 +1,172 @@
+package sdkhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+// CORSConfiguration of the CORS.
+type CORSConfiguration struct {
+	// AllowedOrigins is the list of the exact origin, the wildcard subdomain
+	// e.g. https://*.example.com, or * to allow any origin, default to *
+	AllowedOrigins []string
+	// AllowedMethods restricts the methods answered on the preflight, default
+	// to the methods registered in the mux for the path, or GET, HEAD and POST
+	// when the handler is not the mux
+	AllowedMethods []string
+	// AllowedHeaders answered on the preflight, default to the requested
+	// Access-Control-Request-Headers
+	AllowedHeaders []string
+	// ExposedHeaders is the response headers readable by the browser
+	ExposedHeaders []string
+	// AllowCredentials let the browser send the cookies, it can not be used
+	// with the * origin
+	AllowCredentials bool
+	// MaxAge of the cached preflight, 0 means not sent
+	MaxAge time.Duration
+}
+
+// CORS answer the preflight request using the methods registered in the mux
+// for the requested path, and set the CORS headers of the actual request
+// from the allowed origin. The unmatched path is passed to the handler.
+//
+//	http.Server{Handler: sdkhttp.CORS(&sdkhttp.CORSConfiguration{
+//		AllowedOrigins:   []string{"https://*.example.com"},
+//		AllowCredentials: true,
+//		MaxAge:           time.Hour,
+//	}, mux)}
+func CORS(c *CORSConfiguration, h http.Handler) http.Handler {
+	c0 := CORSConfiguration{AllowedOrigins: []string{"*"}}
+	if c != nil {
+		c0 = *c
+		if len(c0.AllowedOrigins) < 1 {
+			c0.AllowedOrigins = []string{"*"}
+		}
+	}
+
+	anyOrigin := false
+
+	for _, origin := range c0.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		} else if strings.Count(origin, "*") > 1 || (strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			panic("cors: invalid origin " + origin)
+		}
+	}
+
+	if anyOrigin && c0.AllowCredentials {
+		panic("cors: the * origin can not be used with the credentials")
+	}
+
+	muxMethods, _ := h.(interface{ AllowedMethods(*http.Request) []string })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !corsAllowOrigin(c0.AllowedOrigins, origin) {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		if !preflight {
+			corsHeaders(header, &c0, anyOrigin, origin)
+
+			if len(c0.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(c0.ExposedHeaders, ", "))
+			}
+
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		methods := c0.AllowedMethods
+		if muxMethods != nil {
+			registered := muxMethods.AllowedMethods(r)
+			if len(registered) < 1 {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			methods = sdk.IfThenElse(len(methods) > 0, corsIntersect(registered, methods), registered)
+		} else if len(methods) < 1 {
+			methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+		}
+
+		corsHeaders(header, &c0, anyOrigin, origin)
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+		if allowed := c0.AllowedHeaders; len(allowed) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(allowed, ", "))
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+
+		if c0.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(c0.MaxAge.Seconds())))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func corsHeaders(header http.Header, c *CORSConfiguration, anyOrigin bool, origin string) {
+	header.Set("Access-Control-Allow-Origin", sdk.IfThenElse(anyOrigin, "*", origin))
+
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsAllowOrigin match the origin case-insensitively, the wildcard matches
+// one or more subdomains but not the apex domain.
+func corsAllowOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, s := range allowed {
+		s = strings.ToLower(s)
+
+		switch prefix, suffix, wildcard := strings.Cut(s, "*"); {
+		case s == "*", s == origin:
+			return true
+		case wildcard && len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+			!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:"):
+			return true
+		}
+	}
+
+	return false
+}
+
+// corsIntersect keep the registered methods that are configured.
+func corsIntersect(registered, configured []string) []string {
+	methods := make([]string, 0, len(registered))
+
+	for _, method := range registered {
+		for _, m := range configured {
+			if strings.EqualFold(method, m) {
+				methods = append(methods, method)
+
+				break
+			}
+		}
+	}
+
+	return methods
+}
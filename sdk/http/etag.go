@@ -0,0 +1,265 @@
+package sdkhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+var ErrPreconditionFailed = sdk.Errorf("brock/sdkhttp: precondition failed")
+
+// ETagConfiguration of the ETag.
+type ETagConfiguration struct {
+	// Weak emit the W/ prefixed ETag, for the response that is semantically
+	// equivalent but not byte-for-byte identical, e.g. before the Compress
+	Weak bool
+	// MaxSize of the buffered response, the larger response is streamed
+	// without the ETag, default to 1 MiB
+	MaxSize int
+}
+
+// ETag buffer the 200 response of the GET request to emit the ETag hashed
+// from the body, unless the handler already supplied the validators via
+// WrapHandler.Precondition, then answer the If-None-Match and
+// If-Modified-Since with 304 or the failing If-Match with 412. The HEAD
+// request is served as the GET without the body so it has the same
+// validators.
+//
+//	http.Server{Handler: sdkhttp.ETag(nil, mux)}
+func ETag(c *ETagConfiguration, h http.Handler) http.Handler {
+	c0 := ETagConfiguration{MaxSize: 1 << 20}
+	if c != nil {
+		c0.Weak = c.Weak
+
+		if c.MaxSize > 0 {
+			c0.MaxSize = c.MaxSize
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		// the HEAD is served as the GET so its body is hashed, then dropped
+		ew, r2 := &etagWriter{responseWriter: responseWriter{ResponseWriter: w}, max: c0.MaxSize}, r
+		if r.Method == http.MethodHead {
+			ew.head = true
+			r2 = r.Clone(r.Context())
+			r2.Method = http.MethodGet
+		}
+
+		h.ServeHTTP(ew, r2)
+		ew.finish(r, c0.Weak)
+	})
+}
+
+// Precondition set the ETag and Last-Modified validators of the current
+// representation then evaluate the conditional request as in RFC 7232
+// section 6. When the precondition fails the 304 or the 412 problem is sent
+// and true is returned so the handler can stop, e.g. before the PUT
+// overwrites the concurrent update.
+func (x *handler) Precondition(etag string, lastModified time.Time) bool {
+	if etag != "" && !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+
+	if etag != "" {
+		x.w.Header().Set("ETag", etag)
+	}
+
+	if !lastModified.IsZero() {
+		x.w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	switch precondition(x.r, etag, lastModified) {
+	case http.StatusNotModified:
+		_, _ = x.Send(http.StatusNotModified, nil, nil)
+	case http.StatusPreconditionFailed:
+		_, _ = x.Problem(&StatusError{Code: http.StatusPreconditionFailed, Err: ErrPreconditionFailed})
+	default:
+		return false
+	}
+
+	return true
+}
+
+// precondition return 304 or 412 when the conditional request fails, or 0.
+func precondition(r *http.Request, etag string, lastModified time.Time) int {
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	lastModified = lastModified.Truncate(time.Second)
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !etagMatch(ifMatch, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagMatch(ifNoneMatch, etag, false) {
+			return sdk.IfThenElse(safe, http.StatusNotModified, http.StatusPreconditionFailed)
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && safe && !lastModified.IsZero() {
+		if !lastModified.After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// etagMatch compare the list of the entity tags with the etag, the strong
+// comparison doesn't match the weak tag.
+func etagMatch(list, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	} else if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+
+		switch {
+		case strong && (strings.HasPrefix(s, "W/") || strings.HasPrefix(etag, "W/")):
+		case strings.TrimPrefix(s, "W/") == strings.TrimPrefix(etag, "W/"):
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagWriter buffer the response up to the max before deciding whether the
+// validators are evaluated.
+type etagWriter struct {
+	responseWriter
+	max  int
+	head bool
+
+	code        int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (x *etagWriter) WriteHeader(statusCode int) {
+	if statusCode < http.StatusOK || x.passthrough {
+		x.responseWriter.WriteHeader(statusCode)
+
+		return
+	} else if x.code != 0 {
+		return
+	}
+
+	x.code = statusCode
+
+	if statusCode != http.StatusOK {
+		x.pass()
+	}
+}
+
+func (x *etagWriter) Write(p []byte) (int, error) {
+	if x.code == 0 {
+		x.code = http.StatusOK
+	}
+
+	if !x.passthrough && x.buf.Len()+len(p) > x.max {
+		x.pass()
+	}
+
+	if x.passthrough && x.head {
+		return len(p), nil
+	} else if x.passthrough {
+		return x.responseWriter.Write(p)
+	}
+
+	return x.buf.Write(p)
+}
+
+// Flush send the buffered response without the ETag, used by
+// WrapHandler.Stream.
+func (x *etagWriter) Flush() {
+	if x.code == 0 {
+		x.code = http.StatusOK
+	}
+
+	x.pass()
+
+	x.responseWriter.Flush()
+}
+
+func (x *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := x.responseWriter.Hijack()
+	if err == nil {
+		x.passthrough = true
+	}
+
+	return conn, rw, err
+}
+
+func (x *etagWriter) pass() {
+	if x.passthrough {
+		return
+	}
+
+	x.passthrough = true
+	x.responseWriter.WriteHeader(x.code)
+
+	if !x.head {
+		_, _ = x.responseWriter.Write(x.buf.Bytes())
+	}
+
+	x.buf.Reset()
+}
+
+// finish hash the buffered GET response unless the ETag is supplied, then
+// send the 304, 412 or the buffered response.
+func (x *etagWriter) finish(r *http.Request, weak bool) {
+	if x.passthrough || x.code == 0 {
+		return
+	}
+
+	header := x.Header()
+
+	etag := header.Get("ETag")
+	if etag == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		sum := sha256.Sum256(x.buf.Bytes())
+		etag = sdk.IfThenElse(weak, "W/", "") + `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		header.Set("ETag", etag)
+	}
+
+	lastModified, _ := http.ParseTime(header.Get("Last-Modified"))
+
+	switch precondition(r, etag, lastModified) {
+	case http.StatusNotModified:
+		for _, k := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			header.Del(k)
+		}
+
+		x.responseWriter.WriteHeader(http.StatusNotModified)
+	case http.StatusPreconditionFailed:
+		for _, k := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			header.Del(k)
+		}
+
+		// the handler has sent the response to the buffer, not to the client
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyMiddlewareAlreadySent{}, nil))
+		_, _ = Wrap.Handler(&x.responseWriter, r).Problem(&StatusError{Code: http.StatusPreconditionFailed, Err: ErrPreconditionFailed})
+	default:
+		x.pass()
+	}
+}
@@ -0,0 +1,72 @@
+package sdkhttp
+
+import (
+	"net/http"
+)
+
+type muxGroup struct {
+	mux         *mux
+	host        string
+	prefix      string
+	middlewares []http.Handler
+}
+
+// Group create a nested sub-router, inheriting the prefix and middlewares.
+func (x *muxGroup) Group(prefix string, middlewares ...http.Handler) *muxGroup {
+	host, path := x.mux.validate("prefix", prefix)
+
+	return &muxGroup{
+		mux:         x.mux,
+		host:        x.with(host),
+		prefix:      x.join(path),
+		middlewares: append(append(make([]http.Handler, 0), x.middlewares...), middlewares...),
+	}
+}
+
+// Handle register http.Handler based on the prefixed pattern.
+func (x *muxGroup) Handle(method, pattern string, h http.Handler) *muxGroup {
+	host, path := x.mux.validate("path", pattern)
+
+	if h != nil && len(x.middlewares) > 0 {
+		h = Wrap.Middleware(append(append(make([]http.Handler, 0), x.middlewares...), h)...)
+	}
+
+	x.mux.Handle(method, x.with(host)+x.join(path), h)
+
+	return x
+}
+
+// Name the route registered by the last Handle call, see mux.Name.
+func (x *muxGroup) Name(name string) *muxGroup {
+	x.mux.Name(name)
+
+	return x
+}
+
+// Describe the route registered by the last Handle call, see mux.Describe.
+func (x *muxGroup) Describe(doc RouteDoc) *muxGroup {
+	x.mux.Describe(doc)
+
+	return x
+}
+
+func (x *muxGroup) with(host string) string {
+	if host != "" && x.host != "" {
+		panic("host: already defined: " + x.host)
+	} else if host == "" {
+		return x.host
+	}
+
+	return host
+}
+
+func (x *muxGroup) join(pattern string) string {
+	switch {
+	case x.prefix == "" || x.prefix == "/":
+		return pattern
+	case pattern == "/":
+		return x.prefix
+	}
+
+	return x.prefix + pattern
+}
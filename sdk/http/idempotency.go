@@ -0,0 +1,352 @@
+package sdkhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+	sdksql "github.com/brick-io/brock/sdk/sql"
+)
+
+var (
+	ErrIdempotencyConflict = sdk.Errorf("brock/sdkhttp: idempotency key is in progress")
+	ErrIdempotencyMismatch = sdk.Errorf("brock/sdkhttp: idempotency key is reused for a different request")
+)
+
+// IdempotencyRecord of the Idempotency-Key, the Status is 0 while the first
+// request is in progress.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore lock and store the response of the key.
+type IdempotencyStore interface {
+	// Lock the key for the fingerprint until the ttl, the existing record is
+	// returned when the key is already locked or stored
+	Lock(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Save the response of the locked key until the ttl
+	Save(ctx context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error
+	// Unlock the key without the response so it can be retried
+	Unlock(ctx context.Context, key string) error
+}
+
+// IdempotencyConfiguration of the Idempotency.
+type IdempotencyConfiguration struct {
+	// Store default to IdempotencyMemory
+	Store IdempotencyStore
+	// Header of the key, default to Idempotency-Key
+	Header string
+	// Scope the key per client, e.g. the user ID, default to the same scope
+	Scope func(r *http.Request) string
+	// TTL of the stored response, default to 24 hours
+	TTL time.Duration
+	// LockTimeout release the lock of the request that never finished, e.g.
+	// the crashed instance, default to 1 minute
+	LockTimeout time.Duration
+	// MaxBodySize of the request fingerprinted, default to 1 MiB
+	MaxBodySize int64
+}
+
+// Idempotency honor the Idempotency-Key of the unsafe methods, the first
+// request locks the key and its response is stored then replayed with the
+// Idempotent-Replayed header to the retries. The key reused with the
+// different method, path or body is rejected with 422, and the retry while
+// the first is in progress is rejected with 409. The 5xx response is not
+// stored so the client can retry.
+//
+//	mux.Handle("POST", "/payments", sdkhttp.Idempotency(&sdkhttp.IdempotencyConfiguration{
+//		Store: sdkhttp.IdempotencySQL(db, "idempotency_keys"),
+//		Scope: func(r *http.Request) string { return userID(r) },
+//	}, pay))
+func Idempotency(c *IdempotencyConfiguration, h http.Handler) http.Handler {
+	c0 := IdempotencyConfiguration{Header: "Idempotency-Key", TTL: 24 * time.Hour, LockTimeout: time.Minute, MaxBodySize: 1 << 20}
+	if c != nil {
+		c0.Store, c0.Scope = c.Store, c.Scope
+		c0.Header = sdk.IfThenElse(c.Header != "", c.Header, c0.Header)
+		c0.TTL = sdk.IfThenElse(c.TTL > 0, c.TTL, c0.TTL)
+		c0.LockTimeout = sdk.IfThenElse(c.LockTimeout > 0, c.LockTimeout, c0.LockTimeout)
+		c0.MaxBodySize = sdk.IfThenElse(c.MaxBodySize > 0, c.MaxBodySize, c0.MaxBodySize)
+	}
+
+	if c0.Store == nil {
+		c0.Store = IdempotencyMemory()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(c0.Header)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			key = ""
+		}
+
+		if key == "" {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		wr := Wrap.Handler(w, r)
+
+		if len(key) > 255 {
+			_, _ = wr.Problem(&StatusError{Code: http.StatusBadRequest, Err: sdk.Errorf("brock/sdkhttp: %s is too long", c0.Header)})
+
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c0.MaxBodySize))
+		if err != nil {
+			_, _ = wr.Problem(&StatusError{Code: http.StatusRequestEntityTooLarge, Err: err})
+
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if c0.Scope != nil {
+			key = c0.Scope(r) + ":" + key
+		}
+
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		rec, err := c0.Store.Lock(r.Context(), key, fingerprint, c0.LockTimeout)
+
+		switch {
+		case err != nil:
+			_, _ = wr.Problem(&sdk.WrapError{Err: err, Msg: "brock/sdkhttp: idempotency lock"})
+		case rec != nil && rec.Fingerprint != fingerprint:
+			_, _ = wr.Problem(&StatusError{Code: http.StatusUnprocessableEntity, Err: ErrIdempotencyMismatch})
+		case rec != nil && rec.Status == 0:
+			w.Header().Set("Retry-After", "1")
+			_, _ = wr.Problem(&StatusError{Code: http.StatusConflict, Err: ErrIdempotencyConflict})
+		case rec != nil:
+			for k, vs := range rec.Header {
+				w.Header()[k] = vs
+			}
+
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(rec.Status)
+			_, _ = w.Write(rec.Body)
+		default:
+			idempotencyServe(&c0, key, fingerprint, h, w, r)
+		}
+	})
+}
+
+// idempotencyServe record the response of the locked key, the key is unlocked
+// on 5xx or panic.
+func idempotencyServe(c *IdempotencyConfiguration, key, fingerprint string, h http.Handler, w http.ResponseWriter, r *http.Request) {
+	iw := &idempotencyWriter{responseWriter: responseWriter{ResponseWriter: w}}
+	// the response is stored even when the client has gone
+	ctx := context.Background()
+
+	defer func() {
+		rcv := recover()
+
+		var err error
+		if rcv != nil || iw.Status() >= http.StatusInternalServerError || iw.hijacked {
+			err = c.Store.Unlock(ctx, key)
+		} else {
+			err = c.Store.Save(ctx, key, &IdempotencyRecord{fingerprint, iw.Status(), iw.header, iw.body.Bytes()}, c.TTL)
+		}
+
+		if err != nil {
+			sdkotel.Log(r.Context()).Error().Err(err).Str("key", key).Msg("brock/sdkhttp: idempotency")
+		}
+
+		if rcv != nil {
+			panic(rcv)
+		}
+	}()
+
+	h.ServeHTTP(iw, r)
+}
+
+// idempotencyWriter record the header & body written to the client.
+type idempotencyWriter struct {
+	responseWriter
+	header   http.Header
+	body     bytes.Buffer
+	hijacked bool
+}
+
+func (x *idempotencyWriter) WriteHeader(statusCode int) {
+	if x.header == nil && statusCode >= http.StatusOK {
+		x.header = x.ResponseWriter.Header().Clone()
+	}
+
+	x.responseWriter.WriteHeader(statusCode)
+}
+
+func (x *idempotencyWriter) Write(p []byte) (int, error) {
+	if x.header == nil {
+		x.header = x.ResponseWriter.Header().Clone()
+	}
+
+	n, err := x.responseWriter.Write(p)
+	x.body.Write(p[:n])
+
+	return n, err
+}
+
+func (x *idempotencyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	x.hijacked = true
+
+	return x.responseWriter.Hijack()
+}
+
+// IdempotencyMemory store the records in memory, for the single instance.
+func IdempotencyMemory() IdempotencyStore {
+	return &idempotencyMemory{records: make(map[string]*idempotencyMemoryRecord), now: time.Now}
+}
+
+type idempotencyMemoryRecord struct {
+	IdempotencyRecord
+	expires time.Time
+}
+
+type idempotencyMemory struct {
+	mu      sync.Mutex
+	records map[string]*idempotencyMemoryRecord
+	swept   time.Time
+	now     func() time.Time
+}
+
+func (x *idempotencyMemory) Lock(_ context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := x.now()
+
+	if now.Sub(x.swept) > time.Minute {
+		for k, rec := range x.records {
+			if now.After(rec.expires) {
+				delete(x.records, k)
+			}
+		}
+
+		x.swept = now
+	}
+
+	if rec, ok := x.records[key]; ok && !now.After(rec.expires) {
+		cp := rec.IdempotencyRecord
+
+		return &cp, nil
+	}
+
+	x.records[key] = &idempotencyMemoryRecord{IdempotencyRecord{Fingerprint: fingerprint}, now.Add(ttl)}
+
+	return nil, nil //nolint:nilnil
+}
+
+func (x *idempotencyMemory) Save(_ context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.records[key] = &idempotencyMemoryRecord{*rec, x.now().Add(ttl)}
+
+	return nil
+}
+
+func (x *idempotencyMemory) Unlock(_ context.Context, key string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if rec, ok := x.records[key]; ok && rec.Status == 0 {
+		delete(x.records, key)
+	}
+
+	return nil
+}
+
+// IdempotencySQL store the records shared across the instances, the table is
+// expected to be created as follows.
+//
+//	CREATE TABLE idempotency_keys (
+//		key         TEXT   NOT NULL PRIMARY KEY,
+//		fingerprint TEXT   NOT NULL,
+//		status      INT    NOT NULL,
+//		header      TEXT   NOT NULL,
+//		body        BYTEA  NOT NULL,
+//		expires     BIGINT NOT NULL
+//	);
+func IdempotencySQL(conn sdksql.TxConn, table string) IdempotencyStore {
+	return &idempotencySQL{conn: conn, table: table, now: time.Now}
+}
+
+type idempotencySQL struct {
+	conn  sdksql.TxConn
+	table string
+	now   func() time.Time
+}
+
+func (x *idempotencySQL) Lock(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	now := x.now()
+
+	query := `INSERT INTO ` + x.table + ` (key, fingerprint, status, header, body, expires) ` +
+		`VALUES ($1, $2, 0, '', '', $3) ON CONFLICT (key) DO UPDATE SET ` +
+		`fingerprint = EXCLUDED.fingerprint, status = 0, header = '', body = '', expires = EXCLUDED.expires ` +
+		`WHERE ` + x.table + `.expires < $4 RETURNING key`
+
+	var locked string
+
+	err := x.conn.QueryRowContext(ctx, query, key, fingerprint, now.Add(ttl).UnixNano(), now.UnixNano()).Scan(&locked)
+	if err == nil {
+		return nil, nil //nolint:nilnil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	rec, header := new(IdempotencyRecord), ""
+	query = `SELECT fingerprint, status, header, body FROM ` + x.table + ` WHERE key = $1`
+
+	err = x.conn.QueryRowContext(ctx, query, key).Scan(&rec.Fingerprint, &rec.Status, &header, &rec.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// expired right after the lock attempt, treat as in progress
+		return &IdempotencyRecord{Fingerprint: fingerprint}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if header != "" {
+		if err := sdk.JSON.Unmarshal([]byte(header), &rec.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+func (x *idempotencySQL) Save(ctx context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	header, err := sdk.JSON.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE ` + x.table + ` SET status = $2, header = $3, body = $4, expires = $5 WHERE key = $1`
+	_, err = x.conn.ExecContext(ctx, query, key, rec.Status, string(header), rec.Body, x.now().Add(ttl).UnixNano())
+
+	return err
+}
+
+func (x *idempotencySQL) Unlock(ctx context.Context, key string) error {
+	query := `DELETE FROM ` + x.table + ` WHERE key = $1 AND status = 0`
+	_, err := x.conn.ExecContext(ctx, query, key)
+
+	return err
+}
@@ -22,17 +22,53 @@ func (multipartForm) WithWriter(w io.Writer) func(*multipart.Writer) {
 	}
 }
 
-func (multipartForm) WithField(key, value string) func(*multipart.Writer) {
+// WithField ignore the error, use Field to get it.
+func (x multipartForm) WithField(key, value string) func(*multipart.Writer) {
 	return func(mw *multipart.Writer) {
-		_ = mw.WriteField(key, value)
+		_ = x.Field(key, value)(mw)
 	}
 }
 
-func (multipartForm) WithFile(key, filename string, r io.Reader) func(*multipart.Writer) {
+// WithFile ignore the error, use File to get it.
+func (x multipartForm) WithFile(key, filename string, r io.Reader) func(*multipart.Writer) {
 	return func(mw *multipart.Writer) {
+		_ = x.File(key, filename, r)(mw)
+	}
+}
+
+// Build the multipart.Writer of w by writing the parts in order, the first
+// error stop the rest.
+func (multipartForm) Build(w io.Writer, parts ...func(*multipart.Writer) error) (*multipart.Writer, error) {
+	mw := multipart.NewWriter(w)
+
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+
+		if err := part(mw); err != nil {
+			return mw, err
+		}
+	}
+
+	return mw, nil
+}
+
+// Field write the form field, used by Build and NewRequest.
+func (multipartForm) Field(key, value string) func(*multipart.Writer) error {
+	return func(mw *multipart.Writer) error {
+		return mw.WriteField(key, value)
+	}
+}
+
+// File write the form file copied from r, used by Build and NewRequest.
+func (multipartForm) File(key, filename string, r io.Reader) func(*multipart.Writer) error {
+	return func(mw *multipart.Writer) error {
 		w, err := mw.CreateFormFile(key, filename)
 		if err == nil {
-			_, _ = io.Copy(w, r)
+			_, err = io.Copy(w, r)
 		}
+
+		return err
 	}
 }
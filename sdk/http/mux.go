@@ -1,62 +1,155 @@
 package sdkhttp
 
 import (
-	"encoding/base64"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"runtime/debug"
+	"sort"
 	"strings"
 
 	"github.com/brick-io/brock/sdk"
-	sdkcrypto "github.com/brick-io/brock/sdk/crypto"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
 )
 
-func Mux() *mux {
-	return &mux{
-		entries: make(map[string]muxEntry),
-		panicHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			b64 := base64.RawStdEncoding
-			btoa := func(b []byte) []byte {
-				enc := make([]byte, b64.EncodedLen(len(b)))
-				b64.Encode(enc, b)
-
-				return enc
-			}
-
-			pub, pvt, _ := sdkcrypto.NaCl.Box.Generate()
-			key := sdkcrypto.NaCl.Box.SharedKey(pub, pvt)
-			stack := sdk.Sprint(PanicRecoveryFromRequest(r)) + string(debug.Stack())
-			cipher := sdkcrypto.NaCl.Box.SealWithSharedKey([]byte(stack), key)
-			w.Header().Set("X-Recovery-Code", string(btoa(key[:])))
+var (
+	ErrRouteNotFound   = sdk.Errorf("brock/sdkhttp: route not found")
+	ErrNamedArgInvalid = sdk.Errorf("brock/sdkhttp: named argument does not satisfy the constraint")
+)
 
-			code := http.StatusInternalServerError
-			http.Error(w, http.StatusText(code)+"\n"+string(btoa(cipher)), code)
-		}),
+func Mux() *mux {
+	x := &mux{
+		trees: make(map[string]*muxNode),
+		names: make(map[string]*muxEntry),
 		notFoundHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			code := http.StatusNotFound
 			http.Error(w, http.StatusText(code), code)
 		}),
+		methodNotAllowedHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", strings.Join(AllowedMethodsFromRequest(r), ", "))
+
+			code := http.StatusMethodNotAllowed
+			http.Error(w, http.StatusText(code), code)
+		}),
+		optionsHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", strings.Join(AllowedMethodsFromRequest(r), ", "))
+			w.WriteHeader(http.StatusNoContent)
+		}),
 	}
+
+	x.panicHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusInternalServerError
+		if x.recoveryKey == nil {
+			http.Error(w, http.StatusText(code), code)
+
+			return
+		}
+
+		header, cipher, err := SealRecoveryCode(sdk.Sprint(PanicRecoveryFromRequest(r))+"\n\n"+string(debug.Stack()), x.recoveryKey)
+		if err != nil {
+			sdkotel.Log(r.Context()).Error().Err(err).Msg("brock/sdkhttp: seal recovery code")
+			http.Error(w, http.StatusText(code), code)
+
+			return
+		}
+
+		w.Header().Set(HeaderRecoveryCode, header)
+		http.Error(w, http.StatusText(code)+"\n"+cipher, code)
+	})
+
+	return x
+}
+
+//nolint:gochecknoglobals
+var muxMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
 }
 
 type muxEntry struct {
-	parts []string
+	name    string
+	method  string
+	host    string
+	pattern string
+	parts   []string
+	doc     *RouteDoc
 	http.Handler
 }
 
+// muxNode is a node of the prefix tree, each node represent a single path
+// segment of the registered pattern, the static children are looked up
+// directly while the variable children are tried from the most specific.
+type muxNode struct {
+	part        string
+	pieces      []string
+	constraints []*regexp.Regexp
+	statics     map[string]*muxNode
+	vars        []*muxNode
+	catchAll    *muxNode
+	entry       *muxEntry
+}
+
+//nolint:gochecknoglobals
+var muxConstraints = map[string]*regexp.Regexp{
+	"int":   regexp.MustCompile(`^[-+]?[0-9]+$`),
+	"float": regexp.MustCompile(`^[-+]?[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?$`),
+	"alpha": regexp.MustCompile(`^[a-zA-Z]+$`),
+	"alnum": regexp.MustCompile(`^[a-zA-Z0-9]+$`),
+	"hex":   regexp.MustCompile(`^[a-fA-F0-9]+$`),
+	"uuid":  regexp.MustCompile(`^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}$`),
+	"xid":   regexp.MustCompile(`^[0-9a-vA-V]{20}$`),
+}
+
+// muxHost is the routing table of the host pattern, each label of the host
+// is matched the same way as the path segment.
+type muxHost struct {
+	pattern string
+	labels  []*muxNode
+	trees   map[string]*muxNode
+}
+
+// muxRouter is the routing table that is candidate for the request, with
+// the flattened key-value args parsed from the host.
+type muxRouter struct {
+	trees map[string]*muxNode
+	args  []string
+}
+
 type mux struct {
-	entries         map[string]muxEntry
-	panicHandler    http.Handler
-	notFoundHandler http.Handler
+	trees                   map[string]*muxNode
+	hosts                   []*muxHost
+	names                   map[string]*muxEntry
+	last                    []*muxEntry
+	panicHandler            http.Handler
+	notFoundHandler         http.Handler
+	methodNotAllowedHandler http.Handler
+	optionsHandler          http.Handler
+	caseSensitive           bool
+	trailingSlash           int
+	recoveryKey             *[32]byte
 }
 
-// Handle register http.Handler based on the given pattern.
+// Handle register http.Handler based on the given pattern, the pattern can be
+// prefixed with the host such as "{tenant}.api.example.com/users/{id}".
 func (x *mux) Handle(method, pattern string, h http.Handler) *mux {
 	if ms := strings.Split(method, ","); len(ms) > 1 {
+		last := make([]*muxEntry, 0, len(ms))
+
 		for _, method := range ms {
 			x.Handle(method, pattern, h)
+			last = append(last, x.last...)
 		}
 
+		x.last = last
+
 		return x
 	}
 
@@ -77,13 +170,272 @@ func (x *mux) Handle(method, pattern string, h http.Handler) *mux {
 		http.MethodTrace:
 	}
 
+	host, path := x.validate("path", pattern)
+	entry := &muxEntry{"", method, host, path, x.parts(path), nil, h}
+	trees := x.trees
+
+	if host != "" {
+		_ = x.parts(host + path)
+		trees = x.host(host).trees
+	}
+
+	if trees[method] == nil {
+		trees[method] = new(muxNode)
+	}
+
+	x.insert(trees[method], x.segments(path), entry)
+	x.last = []*muxEntry{entry}
+
+	return x
+}
+
+// host get the routing table of the host pattern, ordered by the number of
+// the static characters.
+func (x *mux) host(pattern string) *muxHost {
+	for _, h := range x.hosts {
+		if h.pattern == pattern {
+			return h
+		}
+	}
+
+	h := &muxHost{pattern: pattern, trees: make(map[string]*muxNode)}
+	for _, label := range x.split(pattern, '.') {
+		h.labels = append(h.labels, x.node(label))
+	}
+
+	weight := func(h *muxHost) (w int) {
+		for _, label := range h.labels {
+			for _, piece := range label.pieces {
+				if x.isStatic(piece) {
+					w += len(piece)
+				}
+			}
+		}
+
+		return w
+	}
+
+	x.hosts = append(x.hosts, h)
+	sort.SliceStable(x.hosts, func(i, j int) bool { return weight(x.hosts[i]) > weight(x.hosts[j]) })
+
+	return h
+}
+
+// validate the pattern is canonical, returning the host and the path part.
+func (x *mux) validate(kind, pattern string) (host, path string) {
 	if len(pattern) < 1 {
-		panic("path: empty")
-	} else if pattern != x.canonicalPath(pattern) {
-		panic("path: should be canonical: use \"" + x.canonicalPath(pattern) + "\" instead of \"" + pattern + "\"")
+		panic(kind + ": empty")
+	}
+
+	if i := strings.Index(pattern, "/"); i > 0 && strings.Contains(pattern[:i], ".") {
+		host, path = pattern[:i], pattern[i:]
+	} else {
+		path = pattern
+	}
+
+	if canonical := x.canonicalHost(host) + x.canonicalPattern(path); pattern != canonical {
+		panic(kind + ": should be canonical: use \"" + canonical + "\" instead of \"" + pattern + "\"")
 	}
 
-	x.entries[method+" "+pattern] = muxEntry{x.parts(pattern), h}
+	return host, path
+}
+
+// Name the route registered by the last Handle call, so the path can be
+// built back using URL.
+func (x *mux) Name(name string) *mux {
+	switch e, ok := x.names[name]; {
+	case name == "":
+		panic("name: empty")
+	case len(x.last) < 1:
+		panic("name: no route registered")
+	case ok && e.host+e.pattern != x.last[0].host+x.last[0].pattern:
+		panic("name: duplicate: " + name)
+	}
+
+	for _, e := range x.last {
+		e.name = name
+	}
+
+	x.names[name] = x.last[0]
+
+	return x
+}
+
+// Describe the route registered by the last Handle call, the metadata is
+// used when generating the OpenAPI document.
+func (x *mux) Describe(doc RouteDoc) *mux {
+	if len(x.last) < 1 {
+		panic("describe: no route registered")
+	}
+
+	for _, e := range x.last {
+		e.doc = &doc
+	}
+
+	return x
+}
+
+// Routes list the registered routes ordered by the pattern then the method.
+func (x *mux) Routes() []Route {
+	routes := make([]Route, 0)
+
+	var walk func(node *muxNode)
+	walk = func(node *muxNode) {
+		if node == nil {
+			return
+		} else if e := node.entry; e != nil {
+			routes = append(routes, x.route(e))
+		}
+
+		for _, child := range node.statics {
+			walk(child)
+		}
+
+		for _, child := range node.vars {
+			walk(child)
+		}
+
+		walk(node.catchAll)
+	}
+
+	for _, tree := range x.trees {
+		walk(tree)
+	}
+
+	for _, h := range x.hosts {
+		for _, tree := range h.trees {
+			walk(tree)
+		}
+	}
+
+	order := make(map[string]int)
+	for i, method := range muxMethods {
+		order[method] = i
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		} else if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+
+		return order[routes[i].Method] < order[routes[j].Method]
+	})
+
+	return routes
+}
+
+func (x *mux) route(e *muxEntry) Route {
+	route := Route{Name: e.name, Method: e.method, Host: e.host, Pattern: e.pattern, Params: make([]RouteParam, 0)}
+
+	for _, part := range e.parts {
+		if x.isVars(part) {
+			key, constraint, catchAll := x.key(part)
+			route.Params = append(route.Params, RouteParam{key, constraint, catchAll})
+		}
+	}
+
+	if e.doc != nil {
+		route.Doc = *e.doc
+	}
+
+	return route
+}
+
+// URL build the path of the named route, the named arguments should exist
+// and satisfy the constraint of the pattern, the route with the host pattern
+// is built as the scheme-relative "//host/path".
+func (x *mux) URL(name string, args url.Values) (string, error) {
+	e, ok := x.names[name]
+	if !ok {
+		return "", sdk.Errorf("%w: %s", ErrRouteNotFound, name)
+	}
+
+	path, err := x.render(e.parts, args)
+	if err != nil || e.host == "" {
+		return path, err
+	}
+
+	host, err := x.render(x.parts(e.host), args)
+
+	return "//" + host + path, err
+}
+
+func (x *mux) render(parts []string, args url.Values) (string, error) {
+	b := new(strings.Builder)
+
+	for _, part := range parts {
+		if !x.isVars(part) {
+			b.WriteString(part)
+
+			continue
+		}
+
+		key, _, catchAll := x.key(part)
+		val := args.Get(key)
+
+		if val == "" {
+			return "", sdk.Errorf("%w: %s", ErrNamedArgNotFound, key)
+		} else if re := x.constraint(part); re != nil && !re.MatchString(val) {
+			return "", sdk.Errorf("%w: %s: %q", ErrNamedArgInvalid, part, val)
+		}
+
+		if !catchAll {
+			b.WriteString(url.PathEscape(val))
+
+			continue
+		}
+
+		segments := strings.Split(val, "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+
+		b.WriteString(strings.Join(segments, "/"))
+	}
+
+	return b.String(), nil
+}
+
+// Group create a sub-router, every pattern registered through it is prefixed
+// and the handler is chained after the middlewares, see Wrap.Middleware.
+func (x *mux) Group(prefix string, middlewares ...http.Handler) *muxGroup {
+	return (&muxGroup{mux: x}).Group(prefix, middlewares...)
+}
+
+// CaseSensitive match the path with the exact case of the pattern, it must
+// be configured before any Handle call, by default the pattern is lowercase
+// and the path is matched case-insensitively, either way the value of the
+// named arguments keep the case of the requested path.
+func (x *mux) CaseSensitive(enable bool) *mux {
+	if len(x.Routes()) > 0 {
+		panic("case sensitive: should be configured before any route registered")
+	}
+
+	x.caseSensitive = enable
+
+	return x
+}
+
+// TrailingSlash configure the request with trailing slash, 0 to match it as
+// if there is none (the default), http.StatusNotFound to not match it, or the
+// redirection status code to redirect to the path without trailing slash.
+func (x *mux) TrailingSlash(code int) *mux {
+	switch code {
+	default:
+		panic("trailing slash: invalid status code: " + sdk.Sprint(code))
+	case
+		0,
+		http.StatusNotFound,
+		http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusSeeOther,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+	}
+
+	x.trailingSlash = code
 
 	return x
 }
@@ -95,6 +447,43 @@ func (x *mux) HandleNotFound(h http.Handler) *mux {
 	return x
 }
 
+// HandleMethodNotAllowed register http.Handler that called when the path is
+// matched but not the method, to access the allowed methods
+//
+//	brock.HTTP.AllowedMethodsFromRequest(r)
+func (x *mux) HandleMethodNotAllowed(h http.Handler) *mux {
+	x.methodNotAllowedHandler = h
+
+	return x
+}
+
+// HandleOptions register http.Handler that called on OPTIONS request when the
+// path is matched but there is no OPTIONS registered, to access the allowed
+// methods
+//
+//	brock.HTTP.AllowedMethodsFromRequest(r)
+func (x *mux) HandleOptions(h http.Handler) *mux {
+	x.optionsHandler = h
+
+	return x
+}
+
+// AllowedMethods list the methods registered for the request path, nil when
+// the path is not matched, it's the same list given to the HandleOptions.
+func (x *mux) AllowedMethods(r *http.Request) []string {
+	return x.allowed(x.routers(r), x.segments(x.cleanPath(r.URL.String())))
+}
+
+// RecoveryKey configure the operator public key, the default panic handler
+// seal the recovered value and the stack trace so only the operator holding
+// the private key could open it, see OpenRecoveryCode. Without the key the
+// default panic handler does not expose anything.
+func (x *mux) RecoveryKey(publicKey *[32]byte) *mux {
+	x.recoveryKey = publicKey
+
+	return x
+}
+
 // HandlePanic register http.Handler that called when panic occurred, to access the recovered value
 //
 //	brock.HTTP.PanicRecoveryFromRequest(r)
@@ -115,82 +504,419 @@ func (x *mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	key := x.requestKey(r)
-	if e, ok := x.entries[key]; len(key) > 0 && ok && e.Handler != nil {
+	path := x.cleanPath(r.URL.String())
+	segments, routers := x.segments(path), x.routers(r)
+
+	if p := r.URL.Path; x.trailingSlash != 0 && len(p) > 1 && p[len(p)-1] == '/' {
+		// collapse the leading slashes, //evil.com is another host to the client
+		target := "/" + strings.TrimLeft(path, "/")
+
+		if x.trailingSlash == http.StatusNotFound || len(x.allowed(routers, segments)) < 1 {
+			x.notFoundHandler.ServeHTTP(w, r)
+		} else if r.URL.RawQuery != "" {
+			http.Redirect(w, r, target+"?"+r.URL.RawQuery, x.trailingSlash)
+		} else {
+			http.Redirect(w, r, target, x.trailingSlash)
+		}
+
+		return
+	}
+
+	if e := x.match(r, r.Method, routers, segments); e != nil && e.Handler != nil {
 		e.ServeHTTP(w, r)
 
 		return
 	}
 
+	// HEAD is served by the GET handler without the body, the GET route is
+	// only matched for HEAD so its named args don't leak into the 405
+	if r.Method == http.MethodHead {
+		if e := x.match(r, http.MethodGet, routers, segments); e != nil && e.Handler != nil {
+			e.ServeHTTP(muxHeadResponseWriter{w}, r)
+
+			return
+		}
+	}
+
+	if allowed := x.allowed(routers, segments); len(allowed) > 0 {
+		Request.Set(r, ctxKeyAllowedMethods{}, allowed)
+
+		if r.Method == http.MethodOptions {
+			x.optionsHandler.ServeHTTP(w, r)
+		} else {
+			x.methodNotAllowedHandler.ServeHTTP(w, r)
+		}
+
+		return
+	}
+
 	x.notFoundHandler.ServeHTTP(w, r)
 }
 
+// routers list the routing tables of the host patterns that match the
+// request host, followed by the routing table without the host.
+func (x *mux) routers(r *http.Request) []muxRouter {
+	routers := make([]muxRouter, 0, 1)
+
+	if len(x.hosts) > 0 {
+		hostname := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			hostname = h
+		}
+
+		labels := strings.Split(strings.ToLower(strings.TrimSuffix(hostname, ".")), ".")
+
+	next:
+		for _, h := range x.hosts {
+			if len(h.labels) != len(labels) {
+				continue
+			}
+
+			args := make([]string, 0)
+
+			for i, label := range labels {
+				var ok bool
+				if args, ok = x.parse(h.labels[i], label, args); !ok {
+					continue next
+				}
+			}
+
+			routers = append(routers, muxRouter{h.trees, args})
+		}
+	}
+
+	return append(routers, muxRouter{x.trees, nil})
+}
+
+// allowed list the methods that have the handler for the request path, from
+// the first routing table that has any.
+func (x *mux) allowed(routers []muxRouter, segments []string) []string {
+	has := make(map[string]bool)
+
+	for _, router := range routers {
+		for method, tree := range router.trees {
+			if e, _ := x.lookup(tree, segments, nil); e != nil && e.Handler != nil {
+				has[method] = true
+			}
+		}
+
+		if len(has) > 0 {
+			break
+		}
+	}
+
+	if len(has) < 1 {
+		return nil
+	}
+
+	has[http.MethodHead] = has[http.MethodHead] || has[http.MethodGet]
+	has[http.MethodOptions] = true
+	allowed := make([]string, 0, len(has))
+
+	for _, method := range muxMethods {
+		if has[method] {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return allowed
+}
+
+// parts split the pattern into the static and the {key} parts, the key can
+// be constrained {key:int}, {key:[a-z]+} or catch the rest of the path
+// {key...}.
 func (x *mux) parts(pattern string) []string {
 	parts, keys := make([]string, 0), make(map[string]struct{})
 
-	for i, p := 0, 0; i < len(pattern); i++ {
+	p := 0
+	for i := 0; i < len(pattern); i++ {
 		if pattern[i] != '{' {
 			continue
 		}
 
-		parts = append(parts, pattern[p:i])
+		if i > p {
+			parts = append(parts, pattern[p:i])
+		}
 
 		// previous rune is '}'
 		if i > 0 && pattern[i-1] == '}' {
 			panic("pattern: need separator")
 		}
 
-		// next rune is '}'
-		if i+1 < len(pattern) && pattern[i+1] == '}' {
+		end := x.closing(pattern, i)
+		if end < 0 {
+			panic("pattern: unclosed key: " + pattern[i:])
+		}
+
+		part := pattern[i : end+1]
+		key, constraint, catchAll := x.key(part)
+
+		switch _, ok := keys[key]; {
+		case key == "":
 			panic("pattern: empty key")
+		case ok:
+			panic("pattern: duplicate key: " + key)
+		case catchAll && (end+1 < len(pattern) || (i > 0 && pattern[i-1] != '/')):
+			panic("pattern: catch-all should be the last segment: " + part)
+		case strings.Contains(constraint, "/"):
+			panic("pattern: invalid constraint: " + part)
 		}
 
-		if i+1 < len(pattern) {
-			s := strings.Index(pattern[i+1:], "}")
-			key := pattern[i+1:][:s]
+		_ = x.constraint(part)
+
+		i, p = end, end+1
+		keys[key] = struct{}{}
 
-			if _, ok := keys[key]; ok {
-				panic("pattern: duplicate key: " + key)
+		parts = append(parts, part)
+	}
+
+	if p < len(pattern) {
+		parts = append(parts, pattern[p:])
+	}
+
+	return parts
+}
+
+// closing find the '}' pair of the '{' at i, braces inside are balanced.
+func (x *mux) closing(pattern string, i int) int {
+	for depth := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// key extract the name, constraint and the catch-all flag of the {key} part.
+func (x *mux) key(part string) (key, constraint string, catchAll bool) {
+	key = part[1 : len(part)-1]
+
+	if strings.HasSuffix(key, "...") {
+		return strings.TrimSuffix(key, "..."), "", true
+	} else if n := strings.Index(key, ":"); n >= 0 {
+		return key[:n], key[n+1:], false
+	}
+
+	return key, "", false
+}
+
+// constraint compile the constraint of the {key} part, the well-known name
+// such as int, float, alpha, alnum, hex, uuid and xid is used before treating
+// it as a regular expression.
+func (x *mux) constraint(part string) *regexp.Regexp {
+	_, constraint, _ := x.key(part)
+	if constraint == "" {
+		return nil
+	} else if re, ok := muxConstraints[constraint]; ok {
+		return re
+	}
+
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		panic("pattern: invalid constraint: " + part)
+	}
+
+	return re
+}
+
+func (x *mux) segments(path string) []string {
+	if path = strings.TrimPrefix(path, "/"); path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
+
+// split is strings.Split that leave the {key} parts untouched.
+func (x *mux) split(pattern string, sep byte) []string {
+	out, p := make([]string, 0), 0
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			if end := x.closing(pattern, i); end > 0 {
+				i = end
 			}
+		case sep:
+			out, p = append(out, pattern[p:i]), i+1
+		}
+	}
+
+	return append(out, pattern[p:])
+}
 
-			i = i + 1 + s
-			p = i + 1
-			keys[key] = struct{}{}
+// node create the muxNode of the part with the compiled constraints.
+func (x *mux) node(part string) *muxNode {
+	pieces := x.parts(part)
+	node := &muxNode{part: part, pieces: pieces, constraints: make([]*regexp.Regexp, len(pieces))}
 
-			parts = append(parts, "{"+key+"}")
+	for i, piece := range pieces {
+		if x.isVars(piece) {
+			node.constraints[i] = x.constraint(piece)
 		}
 	}
 
-	return parts
+	return node
+}
+
+func (x *mux) insert(node *muxNode, segments []string, entry *muxEntry) {
+	for _, part := range segments {
+		pieces := x.parts(part)
+
+		if len(pieces) == 1 && x.isStatic(pieces[0]) {
+			if node.statics == nil {
+				node.statics = make(map[string]*muxNode)
+			}
+
+			if node.statics[part] == nil {
+				node.statics[part] = &muxNode{part: part, pieces: pieces}
+			}
+
+			node = node.statics[part]
+
+			continue
+		}
+
+		if _, _, catchAll := x.key(pieces[0]); len(pieces) == 1 && catchAll {
+			if node.catchAll == nil || node.catchAll.part != part {
+				node.catchAll = &muxNode{part: part, pieces: pieces}
+			}
+
+			node = node.catchAll
+
+			continue
+		}
+
+		var child *muxNode
+
+		for _, v := range node.vars {
+			if v.part == part {
+				child = v
+			}
+		}
+
+		if child == nil {
+			child = x.node(part)
+			node.vars = append(node.vars, child)
+			sort.SliceStable(node.vars, func(i, j int) bool {
+				return x.isMoreSpecific(node.vars[i], node.vars[j])
+			})
+		}
+
+		node = child
+	}
+
+	node.entry = entry
 }
 
-func (x *mux) requestKey(r *http.Request) string {
-	pat, n, u, m := x.canonicalPath(r.URL.String()), 0, make(url.Values), r.Method
-	k := m + " " + pat
+// isMoreSpecific order the variable segments, the one with more static
+// characters is tried first, then the one with more constraints, then the one
+// with more pieces, otherwise the one registered first.
+func (x *mux) isMoreSpecific(a, b *muxNode) bool {
+	weight := func(n *muxNode) (w, c int) {
+		for i, piece := range n.pieces {
+			if x.isStatic(piece) {
+				w += len(piece)
+			} else if n.constraints[i] != nil {
+				c++
+			}
+		}
 
-	if _, ok := x.entries[k]; ok &&
-		!strings.Contains(pat, "{") &&
-		!strings.Contains(pat, "}") && ok {
-		return k // match with exact entry
+		return w, c
 	}
 
-	for k, entry := range x.entries {
-		if strings.Contains(k, m) && len(entry.parts) > 0 {
-			n, u = x.parse(pat, n, u, k)
-			if len(u) > 0 {
-				Request.Set(r, ctxKeyNamedArguments{}, u)
+	wa, ca := weight(a)
+	wb, cb := weight(b)
+
+	switch {
+	case wa != wb:
+		return wa > wb
+	case ca != cb:
+		return ca > cb
+	case len(a.pieces) != len(b.pieces):
+		return len(a.pieces) > len(b.pieces)
+	}
+
+	return false
+}
+
+func (x *mux) match(r *http.Request, method string, routers []muxRouter, segments []string) *muxEntry {
+	var (
+		entry *muxEntry
+		args  []string
+	)
+
+	for _, router := range routers {
+		if tree := router.trees[method]; tree != nil {
+			if entry, args = x.lookup(tree, segments, router.args); entry != nil {
+				break
 			}
+		}
+	}
+
+	if entry == nil {
+		return nil
+	}
 
-			_ = n
+	Request.Set(r, ctxKeyRoutePattern{}, entry.host+entry.pattern)
 
-			return k // match with variables
+	if u := make(url.Values); len(args) > 0 {
+		for i := 0; i+1 < len(args); i += 2 {
+			val, err := url.PathUnescape(args[i+1])
+			x.setKV(u, args[i], sdk.IfThenElse(err == nil, val, args[i+1]))
 		}
+
+		Request.Set(r, ctxKeyNamedArguments{}, u)
 	}
 
-	return "" // no match
+	return entry
+}
+
+// lookup walk the tree from the node, static segments are preferred over the
+// variables and then the catch-all, returning the matched entry and the
+// flattened key-value args.
+func (x *mux) lookup(node *muxNode, segments []string, args []string) (*muxEntry, []string) {
+	if len(segments) < 1 {
+		return node.entry, args
+	}
+
+	if child, ok := node.statics[x.fold(segments[0])]; ok {
+		if entry, args := x.lookup(child, segments[1:], args); entry != nil {
+			return entry, args
+		}
+	}
+
+	for _, child := range node.vars {
+		if args, ok := x.parse(child, segments[0], args); ok {
+			if entry, args := x.lookup(child, segments[1:], args); entry != nil {
+				return entry, args
+			}
+		}
+	}
+
+	if child := node.catchAll; child != nil && child.entry != nil {
+		if rest := strings.Join(segments, "/"); len(rest) > 0 {
+			key, _, _ := x.key(child.part)
+
+			return child.entry, append(args, key, rest)
+		}
+	}
+
+	return nil, args
 }
 
 func (x *mux) canonicalPath(s string) string {
+	return x.fold(x.cleanPath(s))
+}
+
+// cleanPath strip the scheme, host, query, fragment and the trailing slash.
+func (x *mux) cleanPath(s string) string {
 	if h := strings.Index(s, "?"); h > 0 {
 		s = s[0:h]
 	}
@@ -219,37 +945,115 @@ func (x *mux) canonicalPath(s string) string {
 		s = s[:len(s)-1]
 	}
 
-	return strings.ToLower(s)
+	return s
 }
 
-func (x *mux) parse(pattern string, n int, u url.Values, k string) (int, url.Values) {
-	e := x.entries[k]
-	for i, part := range e.parts {
-		switch {
-		case x.isStatic(part):
-			nn := strings.Index(pattern[n:], part)
-			n = n + len(part) + nn
-		case x.isVars(part):
-			key, val := part[1:len(part)-1], ""
+// fold lowercase the s unless the mux is case-sensitive.
+func (x *mux) fold(s string) string {
+	return sdk.IfThenElse(x.caseSensitive, s, strings.ToLower(s))
+}
 
-			if i < len(e.parts)-1 {
-				next := e.parts[i+1]
-				nn := strings.Index(pattern[n:], next)
+// hasPrefix is strings.HasPrefix that respect the case-sensitivity.
+func (x *mux) hasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && x.fold(s[:len(prefix)]) == x.fold(prefix)
+}
 
-				if nn > 0 {
-					val = pattern[n:][:nn]
-					n = nn
+// index is strings.Index that respect the case-sensitivity.
+func (x *mux) index(s, substr string) int {
+	if x.caseSensitive {
+		return strings.Index(s, substr)
+	}
 
-					x.setKV(u, key, val)
-				}
-			} else if n < len(pattern) {
-				val = pattern[n:]
-				x.setKV(u, key, val)
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if x.hasPrefix(s[i:], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// canonicalPattern is the canonicalPath of the pattern, leaving the {key}
+// parts untouched, so the constraint is not altered.
+func (x *mux) canonicalPattern(pattern string) string {
+	return x.mask(pattern, x.canonicalPath)
+}
+
+// canonicalHost is the lowercase host pattern, leaving the {key} parts
+// untouched.
+func (x *mux) canonicalHost(pattern string) string {
+	return x.mask(pattern, strings.ToLower)
+}
+
+// mask apply fn to the pattern without the {key} parts.
+func (x *mux) mask(pattern string, fn func(string) string) string {
+	keys, masked := make([]string, 0), new(strings.Builder)
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '{' {
+			if end := x.closing(pattern, i); end > 0 {
+				keys = append(keys, pattern[i:end+1])
+				masked.WriteString("{}")
+
+				i = end
+
+				continue
+			}
+		}
+
+		masked.WriteByte(pattern[i])
+	}
+
+	s := fn(masked.String())
+	for _, key := range keys {
+		s = strings.Replace(s, "{}", key, 1)
+	}
+
+	return s
+}
+
+// parse match the pieces of a single segment against s, the variable take
+// everything until the next static piece occurred and should satisfy the
+// constraint.
+func (x *mux) parse(node *muxNode, s string, args []string) ([]string, bool) {
+	for i, piece := range node.pieces {
+		if x.isStatic(piece) {
+			if !x.hasPrefix(s, piece) {
+				return args, false
+			}
+
+			s = s[len(piece):]
+
+			continue
+		}
+
+		val := s
+		if i < len(node.pieces)-1 {
+			if n := x.index(s, node.pieces[i+1]); n > 0 {
+				val = s[:n]
+			} else {
+				return args, false
 			}
 		}
+
+		// the constraint is checked against the unescaped value as in render
+		unescaped, err := url.PathUnescape(val)
+		if err != nil {
+			unescaped = val
+		}
+
+		if len(val) < 1 {
+			return args, false
+		} else if re := node.constraints[i]; re != nil && !re.MatchString(unescaped) {
+			return args, false
+		}
+
+		key, _, _ := x.key(piece)
+		args = append(args, key, val)
+		s = s[len(val):]
 	}
 
-	return n, u
+	return args, len(s) < 1
 }
 
 func (x *mux) setKV(u url.Values, key, val string) {
@@ -265,3 +1069,14 @@ func (x *mux) isStatic(part string) bool {
 func (x *mux) isVars(part string) bool {
 	return len(part) > 2 && part[0] == '{' && part[len(part)-1] == '}'
 }
+
+// muxHeadResponseWriter discard the body written by the GET handler.
+type muxHeadResponseWriter struct{ http.ResponseWriter }
+
+func (w muxHeadResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w muxHeadResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
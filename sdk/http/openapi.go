@@ -0,0 +1,332 @@
+package sdkhttp
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+//nolint:gochecknoglobals
+var openAPIComponentName = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// Route describe the registered route, see mux.Routes.
+type Route struct {
+	Name    string
+	Method  string
+	Host    string
+	Pattern string
+	Params  []RouteParam
+	Doc     RouteDoc
+}
+
+// RouteParam describe the {key} part of the pattern.
+type RouteParam struct {
+	Name       string
+	Constraint string
+	CatchAll   bool
+}
+
+// RouteDoc is the optional metadata of the route, Request and Response are
+// the Go values which type is reflected into the schema.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     any
+	Response    any
+	// Status of the Response, default to http.StatusOK
+	Status int
+}
+
+// OpenAPIInfo is the metadata of the API.
+type OpenAPIInfo struct {
+	Title       string `json:"title"                 yaml:"title"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Version     string `json:"version"               yaml:"version"`
+}
+
+// OpenAPIDocument is the OpenAPI 3 document, it also implement the
+// http.Handler that serve the document as JSON or YAML based on the Accept
+// header or the extension of the requested path.
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"    yaml:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"       yaml:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"      yaml:"paths"`
+	Components struct {
+		Schemas map[string]*OpenAPISchema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	} `json:"components" yaml:"components"`
+
+	types map[string]reflect.Type // the type of the component schema
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"     yaml:"summary,omitempty"`
+	Description string                      `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"        yaml:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"  yaml:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"             yaml:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name     string         `json:"name"     yaml:"name"`
+	In       string         `json:"in"       yaml:"in"`
+	Required bool           `json:"required" yaml:"required"`
+	Schema   *OpenAPISchema `json:"schema"   yaml:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required" yaml:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"  yaml:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"       yaml:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema" yaml:"schema"`
+}
+
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"                 yaml:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"                 yaml:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"               yaml:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"              yaml:"pattern,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"             yaml:"nullable,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"                yaml:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"           yaml:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"             yaml:"required,omitempty"`
+}
+
+// OpenAPI generate the OpenAPI 3 document of the routes, the Host is not
+// part of the path thus the routes of the different hosts that share the
+// method and the path will panic, filter the routes to generate the
+// document per host instead. The named struct is registered into the
+// components by its name, or by its package path and name when the name is
+// taken by another type, e.g. the User of the other package.
+//
+//	mux.Handle("GET", "/openapi.json", sdkhttp.OpenAPI(info, mux.Routes()))
+func OpenAPI(info OpenAPIInfo, routes []Route) *OpenAPIDocument {
+	doc := &OpenAPIDocument{OpenAPI: "3.0.3", Info: info, Paths: make(map[string]map[string]*OpenAPIOperation)}
+	doc.Components.Schemas = make(map[string]*OpenAPISchema)
+	doc.types = make(map[string]reflect.Type)
+
+	names := make(map[string]int)
+	for _, route := range routes {
+		names[route.Name]++
+	}
+
+	for _, route := range routes {
+		path := doc.path(route)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+
+		op := &OpenAPIOperation{
+			OperationID: route.Name,
+			Summary:     route.Doc.Summary,
+			Description: route.Doc.Description,
+			Tags:        route.Doc.Tags,
+			Responses:   make(map[string]*OpenAPIResponse),
+		}
+
+		if route.Name != "" && names[route.Name] > 1 {
+			op.OperationID += "_" + strings.ToLower(route.Method)
+		}
+
+		for _, param := range route.Params {
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{param.Name, "path", true, doc.param(param)})
+		}
+
+		if route.Doc.Request != nil {
+			op.RequestBody = &OpenAPIRequestBody{true, map[string]*OpenAPIMediaType{
+				"application/json": {doc.schema(reflect.TypeOf(route.Doc.Request))},
+			}}
+		}
+
+		status := sdk.IfThenElse(route.Doc.Status == 0, http.StatusOK, route.Doc.Status)
+		res := &OpenAPIResponse{Description: http.StatusText(status)}
+
+		if route.Doc.Response != nil {
+			res.Content = map[string]*OpenAPIMediaType{
+				"application/json": {doc.schema(reflect.TypeOf(route.Doc.Response))},
+			}
+		}
+
+		op.Responses[strconv.Itoa(status)] = res
+
+		if _, ok := doc.Paths[path][strings.ToLower(route.Method)]; ok {
+			panic("openapi: duplicate operation: " + route.Method + " " + path)
+		}
+
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return doc
+}
+
+// ServeHTTP implement the http.Handler.
+func (doc *OpenAPIDocument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var _ http.Handler = doc
+
+	parser, contentType := sdk.JSON, "application/json"
+
+	if p := strings.ToLower(r.URL.Path); strings.HasSuffix(p, ".yaml") || strings.HasSuffix(p, ".yml") ||
+		strings.Contains(r.Header.Get("Accept"), "yaml") {
+		parser, contentType = sdk.YAML, "application/yaml"
+	}
+
+	p, err := parser.Marshal(doc)
+	if err != nil {
+		code := http.StatusInternalServerError
+		http.Error(w, http.StatusText(code), code)
+
+		return
+	}
+
+	header := Header.Create(Header.WithKV("Content-Type", contentType+"; charset=utf-8"))
+	_, _ = Wrap.Handler(w, r).Send(http.StatusOK, header, bytes.NewReader(p))
+}
+
+// path convert the pattern into the OpenAPI path template.
+func (doc *OpenAPIDocument) path(route Route) string {
+	path := route.Pattern
+
+	for _, param := range route.Params {
+		switch {
+		case param.CatchAll:
+			path = strings.Replace(path, "{"+param.Name+"...}", "{"+param.Name+"}", 1)
+		case param.Constraint != "":
+			path = strings.Replace(path, "{"+param.Name+":"+param.Constraint+"}", "{"+param.Name+"}", 1)
+		}
+	}
+
+	return path
+}
+
+func (doc *OpenAPIDocument) param(param RouteParam) *OpenAPISchema {
+	switch param.Constraint {
+	case "":
+		return &OpenAPISchema{Type: "string"}
+	case "int":
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case "float":
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case "uuid":
+		return &OpenAPISchema{Type: "string", Format: "uuid"}
+	}
+
+	if re, ok := muxConstraints[param.Constraint]; ok {
+		return &OpenAPISchema{Type: "string", Pattern: re.String()}
+	}
+
+	return &OpenAPISchema{Type: "string", Pattern: "^(?:" + param.Constraint + ")$"}
+}
+
+// schema reflect the type into the schema, the named struct is registered
+// into the components and referenced.
+//
+//nolint:cyclop
+func (doc *OpenAPIDocument) schema(t reflect.Type) *OpenAPISchema {
+	if t == nil {
+		return &OpenAPISchema{}
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	default:
+		return &OpenAPISchema{}
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+
+		return &OpenAPISchema{Type: "array", Items: doc.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: doc.schema(t.Elem())}
+	case reflect.Struct:
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	} else if t.Name() == "" {
+		return doc.object(t)
+	}
+
+	name := openAPIComponentName.ReplaceAllString(t.Name(), "_")
+	for i := 1; doc.types[name] != nil && doc.types[name] != t; i++ {
+		name = openAPIComponentName.ReplaceAllString(t.PkgPath()+"."+t.Name(), "_") +
+			sdk.IfThenElse(i > 1, "_"+strconv.Itoa(i), "")
+	}
+
+	if _, ok := doc.types[name]; !ok {
+		doc.types[name] = t
+		doc.Components.Schemas[name] = new(OpenAPISchema) // placeholder for the recursive type
+		doc.Components.Schemas[name] = doc.object(t)
+	}
+
+	return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func (doc *OpenAPIDocument) object(t reflect.Type) *OpenAPISchema {
+	s := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := doc.object(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+
+			s.Required = append(s.Required, embedded.Required...)
+
+			continue
+		}
+
+		name = sdk.IfThenElse(name == "", f.Name, name)
+		s.Properties[name] = doc.schema(f.Type)
+
+		if f.Type.Kind() == reflect.Pointer {
+			s.Properties[name].Nullable = s.Properties[name].Ref == ""
+		} else if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s
+}
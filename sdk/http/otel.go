@@ -0,0 +1,80 @@
+package sdkhttp
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+)
+
+// Instrument the handler with a server span per request and the request
+// duration & in-flight metrics, when wrapping the mux the span is named after
+// the matched route pattern, the nil tracer or meter fallback to the global.
+//
+//	http.Server{Handler: sdkhttp.Instrument(tracer, meter, mux)}
+func Instrument(tracer *sdkotel.Tracer, meter *sdkotel.Meter, h http.Handler) http.Handler {
+	var t trace.Tracer = otel.Tracer("brock/sdkhttp")
+	if tracer != nil && tracer.Tracer != nil {
+		t = tracer.Tracer
+	}
+
+	m := global.Meter("brock/sdkhttp")
+	if meter != nil && meter.Meter != nil {
+		m = meter.Meter
+	}
+
+	duration, _ := m.SyncFloat64().Histogram("http.server.duration",
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("duration of the inbound HTTP request"),
+	)
+	inflight, _ := m.SyncInt64().UpDownCounter("http.server.active_requests",
+		instrument.WithDescription("number of the in-flight HTTP request"),
+	)
+	propagator := propagation.TraceContext{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, kvs := time.Now(), sdkotel.Attr.KeyValueHTTPRequest(r)
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.Start(ctx, "HTTP "+r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(kvs...))
+
+		defer span.End()
+
+		method := sdkotel.Attr.Key("http.method").String(r.Method)
+		if inflight != nil {
+			inflight.Add(ctx, 1, method)
+			defer inflight.Add(ctx, -1, method)
+		}
+
+		r = r.WithContext(ctx)
+		rw := &responseWriter{ResponseWriter: w}
+		h.ServeHTTP(rw, r)
+
+		kvs = append(sdkotel.Attr.KeyValueHTTPResponse(rw.Status(), rw.written), method)
+		if pattern := RoutePatternFromRequest(r); pattern != "" {
+			kvs = append(kvs, sdkotel.Attr.Key("http.route").String(pattern))
+			span.SetName(r.Method + " " + pattern)
+		}
+
+		span.SetAttributes(kvs...)
+
+		if rcv := PanicRecoveryFromRequest(r); rcv != nil {
+			err := sdk.Errorf("panic: %v", rcv)
+			span.RecordError(err, trace.WithStackTrace(true))
+			span.SetStatus(sdkotel.Code.StatusError(), err.Error())
+		} else if rw.Status() >= http.StatusInternalServerError {
+			span.SetStatus(sdkotel.Code.StatusError(), http.StatusText(rw.Status()))
+		}
+
+		if duration != nil {
+			duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), kvs...)
+		}
+	})
+}
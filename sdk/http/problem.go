@@ -0,0 +1,188 @@
+package sdkhttp
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+)
+
+// StatusError attach the HTTP status code and the problem type to the error
+// passed to WrapHandler.Next, the default is 500 and about:blank.
+//
+//	wr.Next(&sdkhttp.StatusError{Code: http.StatusConflict, Err: &sdk.WrapError{
+//		Err: err, Msg: "insert user", Redact: "the email is already registered",
+//	}})
+type StatusError struct {
+	Code int
+	// Type is the URI reference that identifies the problem type
+	Type string
+	Err  error
+}
+
+func (err *StatusError) Error() string {
+	if err.Err == nil {
+		return http.StatusText(err.Code)
+	}
+
+	return err.Err.Error()
+}
+
+func (err *StatusError) Unwrap() error { return err.Err }
+
+// Problem is the RFC 7807 problem details.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"traceId,omitempty"`
+	// Errors is the extension member of the invalid fields of the
+	// *BindError and the *sdk.FieldError, e.g. sent by WrapHandler.Bind
+	Errors []ProblemField `json:"errors,omitempty"`
+}
+
+// ProblemField is the invalid field of the Problem.
+type ProblemField struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Problem send the error as application/problem+json, the detail is the
+// Redact of sdk.WrapError when exists, else the status text, and the invalid
+// fields of the 4xx are listed in the errors member, while the full chain is
+// logged using the sdkotel.Log in the request context, at the error level
+// only for 5xx.
+func (x *handler) Problem(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+
+	p := &Problem{Type: "about:blank", Status: problemStatus(err), Instance: x.r.URL.RequestURI()}
+	p.Title, p.Detail = http.StatusText(p.Status), http.StatusText(p.Status)
+
+	if p.Status < http.StatusInternalServerError {
+		p.Errors = problemFields(err)
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Type != "" {
+		p.Type = statusErr.Type
+	}
+
+	var wrapErr *sdk.WrapError
+	if errors.As(err, &wrapErr) && wrapErr.Redact != "" {
+		p.Detail = wrapErr.Redact
+	}
+
+	if sc := trace.SpanContextFromContext(x.r.Context()); sc.HasTraceID() {
+		p.TraceID = sc.TraceID().String()
+	}
+
+	log, event := sdkotel.Log(x.r.Context()), (*zerolog.Event)(nil)
+	if p.Status < http.StatusInternalServerError {
+		event = log.Warn()
+	} else {
+		event = log.Error()
+	}
+
+	event.
+		Strs("errors", problemChain(err)).
+		Int("status", p.Status).
+		Str("method", x.r.Method).
+		Str("instance", p.Instance).
+		Str("trace_id", p.TraceID).
+		Msg("brock/sdkhttp: problem")
+
+	body, err := sdk.JSON.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+
+	header := Header.Create(Header.WithKV("Content-Type", "application/problem+json"))
+
+	return x.Send(p.Status, header, bytes.NewReader(body))
+}
+
+// problemFields list the *BindError and the *sdk.FieldError of the
+// sdk.Errors, or nil.
+func problemFields(err error) []ProblemField {
+	var errs sdk.Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	fields := make([]ProblemField, 0)
+
+	for _, each := range errs {
+		var bindErr *BindError
+
+		var fieldErr *sdk.FieldError
+
+		switch {
+		case errors.As(each, &bindErr):
+			fields = append(fields, ProblemField{
+				Field:   bindErr.Field,
+				Message: bindErr.Source + " " + strconv.Quote(bindErr.Key) + ": " + bindErr.Err.Error(),
+			})
+		case errors.As(each, &fieldErr):
+			fields = append(fields, ProblemField{Field: fieldErr.Field, Message: fieldErr.Error()})
+		}
+	}
+
+	return sdk.IfThenElse(len(fields) > 0, fields, nil)
+}
+
+// problemStatus find the status code of the error.
+func problemStatus(err error) int {
+	var statusErr *StatusError
+
+	switch {
+	case errors.As(err, &statusErr) && http.StatusText(statusErr.Code) != "":
+		return statusErr.Code
+	case errors.Is(err, ErrRouteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotAcceptable):
+		return http.StatusNotAcceptable
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, sdk.ErrValidation):
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+// problemChain unwrap the error into its messages, the sdk.WrapError use its
+// Msg so the Redact doesn't hide the cause.
+func problemChain(err error) []string {
+	chain := make([]string, 0)
+
+	for ; err != nil; err = errors.Unwrap(err) {
+		var msg string
+
+		switch e := err.(type) { //nolint:errorlint
+		case *sdk.WrapError:
+			msg = e.Msg
+		case *StatusError:
+			continue
+		default:
+			msg = err.Error()
+		}
+
+		if msg != "" {
+			chain = append(chain, msg)
+		}
+	}
+
+	return chain
+}
@@ -0,0 +1,295 @@
+package sdkhttp
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+	sdksql "github.com/brick-io/brock/sdk/sql"
+)
+
+var ErrRateLimited = sdk.Errorf("brock/sdkhttp: rate limited")
+
+// RateLimitResult of taking a request from the RateLimitStore.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the quota is fully restored
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore count the requests of the key.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RateLimitConfiguration of the RateLimit.
+type RateLimitConfiguration struct {
+	// Limit of the requests per Window
+	Limit  int
+	Window time.Duration
+	// Key of the client, the empty key fallback to RateLimitByIP, default to
+	// RateLimitByIP
+	Key func(r *http.Request) string
+	// Store default to RateLimitTokenBucket
+	Store RateLimitStore
+}
+
+// RateLimit the requests per client, the exceeding request is sent as 429
+// problem with the Retry-After, while every response has the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers. The store error let the
+// request through and is logged using the sdkotel.Log in the request context.
+//
+//	mux.Handle("POST", "/login", sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{
+//		Limit: 5, Window: time.Minute,
+//	}, login))
+//	mux.Handle("GET", "/tenants/{tenant}/reports", sdkhttp.RateLimit(&sdkhttp.RateLimitConfiguration{
+//		Limit: 100, Window: time.Hour, Key: sdkhttp.RateLimitByNamedArg("tenant"),
+//		Store: sdkhttp.RateLimitSQL(db, "rate_limits"),
+//	}, reports))
+func RateLimit(c *RateLimitConfiguration, h http.Handler) http.Handler {
+	if c == nil || c.Limit < 1 || c.Window <= 0 {
+		panic("rate limit: invalid limit or window")
+	}
+
+	key := sdk.IfThenElse(c.Key == nil, RateLimitByIP(), c.Key)
+	store := sdk.IfThenElse(c.Store == nil, RateLimitTokenBucket(), c.Store)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := key(r)
+		if k == "" {
+			k = RateLimitByIP()(r)
+		}
+
+		res, err := store.Take(r.Context(), k, c.Limit, c.Window)
+		if err != nil {
+			sdkotel.Log(r.Context()).Error().Err(err).Str("key", k).Msg("brock/sdkhttp: rate limit")
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		seconds := func(d time.Duration) string { return strconv.Itoa(int(math.Ceil(d.Seconds()))) }
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(c.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", seconds(res.RetryAfter))
+			_, _ = Wrap.Handler(w, r).Problem(&StatusError{Code: http.StatusTooManyRequests, Err: ErrRateLimited})
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitByIP key the request by the IP of the RemoteAddr, put the proxy
+// header handling before it when running behind the trusted proxy.
+func RateLimitByIP() func(r *http.Request) string {
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+		return "ip:" + sdk.IfThenElse(err != nil, r.RemoteAddr, host)
+	}
+}
+
+// RateLimitByHeader key the request by the header, e.g. the API key.
+func RateLimitByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		v := r.Header.Get(name)
+
+		return sdk.IfThenElse(v == "", "", "header:"+name+":"+v)
+	}
+}
+
+// RateLimitByNamedArg key the request by the named argument of the route, the
+// RateLimit must wrap the handler registered to the mux.
+func RateLimitByNamedArg(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		v := NamedArgsFromRequest(r).Get(name)
+
+		return sdk.IfThenElse(v == "", "", "arg:"+name+":"+v)
+	}
+}
+
+// RateLimitTokenBucket store the bucket of each key in memory, the bucket
+// hold the Limit tokens and refill them evenly across the Window.
+func RateLimitTokenBucket() RateLimitStore {
+	return &rateLimitTokenBucket{buckets: make(map[string]*rateLimitBucket), now: time.Now}
+}
+
+type rateLimitBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimitTokenBucket struct {
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+func (x *rateLimitTokenBucket) Take(_ context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now, capacity := x.now(), float64(limit)
+	rate := capacity / window.Seconds()
+
+	if now.Sub(x.swept) > window {
+		for k, b := range x.buckets {
+			if now.Sub(b.last) > window {
+				delete(x.buckets, k)
+			}
+		}
+
+		x.swept = now
+	}
+
+	b, ok := x.buckets[key]
+	if !ok {
+		b = &rateLimitBucket{tokens: capacity, last: now}
+		x.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := RateLimitResult{Allowed: b.tokens >= 1}
+	if res.Allowed {
+		b.tokens--
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((capacity - b.tokens) / rate * float64(time.Second))
+
+	return res, nil
+}
+
+// RateLimitSlidingWindow store the counter of each key in memory, the count
+// of the previous window is weighted by its overlap with the sliding window.
+func RateLimitSlidingWindow() RateLimitStore {
+	return &rateLimitSlidingWindow{counters: make(map[string][2]int64), now: time.Now}
+}
+
+type rateLimitSlidingWindow struct {
+	mu       sync.Mutex
+	counters map[string][2]int64 // window start in ns & count
+	swept    time.Time
+	now      func() time.Time
+}
+
+func (x *rateLimitSlidingWindow) Take(_ context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := x.now()
+	start := now.Truncate(window).UnixNano()
+	prevKey, currKey := key+"\x00"+strconv.FormatInt(start-int64(window), 10), key+"\x00"+strconv.FormatInt(start, 10)
+
+	if now.Sub(x.swept) > window {
+		for k, v := range x.counters {
+			if v[0] < start-int64(window) {
+				delete(x.counters, k)
+			}
+		}
+
+		x.swept = now
+	}
+
+	curr := x.counters[currKey]
+	curr[0], curr[1] = start, curr[1]+1
+	x.counters[currKey] = curr
+
+	return rateLimitSlide(now, window, limit, x.counters[prevKey][1], curr[1]), nil
+}
+
+// RateLimitSQL is the sliding window store shared across the instances, the
+// table is expected to be created as follows.
+//
+//	CREATE TABLE rate_limits (
+//		key   TEXT   NOT NULL,
+//		start BIGINT NOT NULL,
+//		count BIGINT NOT NULL,
+//		PRIMARY KEY (key, start)
+//	);
+func RateLimitSQL(conn sdksql.TxConn, table string) RateLimitStore {
+	return &rateLimitSQL{conn: conn, table: table, now: time.Now}
+}
+
+type rateLimitSQL struct {
+	conn  sdksql.TxConn
+	table string
+	now   func() time.Time
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+func (x *rateLimitSQL) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	now := x.now()
+	start := now.Truncate(window).UnixNano()
+
+	x.mu.Lock()
+	if now.Sub(x.swept) > window {
+		x.swept = now
+		x.mu.Unlock()
+
+		query := `DELETE FROM ` + x.table + ` WHERE start < $1`
+		if _, err := x.conn.ExecContext(ctx, query, start-int64(window)); err != nil {
+			return RateLimitResult{}, err
+		}
+	} else {
+		x.mu.Unlock()
+	}
+
+	var prev, curr int64
+
+	query := `INSERT INTO ` + x.table + ` (key, start, count) VALUES ($1, $2, 1) ` +
+		`ON CONFLICT (key, start) DO UPDATE SET count = ` + x.table + `.count + 1 ` +
+		`RETURNING count, COALESCE((SELECT count FROM ` + x.table + ` WHERE key = $1 AND start = $3), 0)`
+
+	err := x.conn.QueryRowContext(ctx, query, key, start, start-int64(window)).Scan(&curr, &prev)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	return rateLimitSlide(now, window, limit, prev, curr), nil
+}
+
+// rateLimitSlide estimate the count of the sliding window that includes the
+// current request, the denied request is counted as well.
+func rateLimitSlide(now time.Time, window time.Duration, limit int, prev, curr int64) RateLimitResult {
+	remaining := window - now.Sub(now.Truncate(window))
+	estimated := float64(prev)*float64(remaining)/float64(window) + float64(curr)
+
+	res := RateLimitResult{Allowed: estimated <= float64(limit), Reset: remaining + window}
+	res.Remaining = int(math.Max(0, float64(limit)-math.Ceil(estimated)))
+
+	if !res.Allowed {
+		// wait until the next request fits, either when the previous window
+		// slides out enough or after the current window becomes the previous
+		target := float64(limit - 1)
+		if float64(curr) <= target {
+			res.RetryAfter = remaining - time.Duration((target-float64(curr))/float64(prev)*float64(window))
+		} else {
+			res.RetryAfter = remaining + time.Duration((1-target/float64(curr))*float64(window))
+		}
+	}
+
+	return res
+}
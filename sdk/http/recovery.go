@@ -0,0 +1,61 @@
+package sdkhttp
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/brick-io/brock/sdk"
+	sdkcrypto "github.com/brick-io/brock/sdk/crypto"
+)
+
+// HeaderRecoveryCode carry the ephemeral public key of the sealed panic.
+const HeaderRecoveryCode = "X-Recovery-Code"
+
+var ErrInvalidRecoveryCode = sdk.Errorf("brock/sdkhttp: invalid recovery code")
+
+// SealRecoveryCode seal the plaintext for the operator public key using an
+// ephemeral keypair, returning the base64 of the ephemeral public key (the
+// header) and the base64 of the ciphertext (the payload).
+func SealRecoveryCode(plaintext string, operatorPublicKey *[32]byte) (header, payload string, err error) {
+	b64 := base64.RawStdEncoding
+
+	pub, pvt, err := sdkcrypto.NaCl.Box.Generate()
+	if err != nil {
+		return "", "", err
+	}
+
+	cipher := sdkcrypto.NaCl.Box.Seal([]byte(plaintext), operatorPublicKey, pvt)
+
+	return b64.EncodeToString(pub[:]), b64.EncodeToString(cipher), nil
+}
+
+// OpenRecoveryCode open the payload sealed by SealRecoveryCode using the
+// operator private key, the payload can be the whole response body.
+func OpenRecoveryCode(header, payload string, operatorPrivateKey *[32]byte) (string, error) {
+	b64 := base64.RawStdEncoding
+
+	if lines := strings.Split(strings.TrimSpace(payload), "\n"); len(lines) > 0 {
+		payload = strings.TrimSpace(lines[len(lines)-1])
+	}
+
+	pub, err := b64.DecodeString(strings.TrimSpace(header))
+	if err != nil || len(pub) != 32 {
+		return "", sdk.Errorf("%w: header", ErrInvalidRecoveryCode)
+	}
+
+	cipher, err := b64.DecodeString(payload)
+	if err != nil || len(cipher) < 24 {
+		return "", sdk.Errorf("%w: payload", ErrInvalidRecoveryCode)
+	}
+
+	var peersPublicKey [32]byte
+
+	copy(peersPublicKey[:], pub)
+
+	plain, ok := sdkcrypto.NaCl.Box.Open(cipher, &peersPublicKey, operatorPrivateKey)
+	if !ok {
+		return "", sdk.Errorf("%w: cannot be opened with the key", ErrInvalidRecoveryCode)
+	}
+
+	return string(plain), nil
+}
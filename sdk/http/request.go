@@ -1,9 +1,15 @@
 package sdkhttp
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
+	neturl "net/url"
+
+	"github.com/brick-io/brock/sdk"
 )
 
 //nolint:gochecknoglobals
@@ -37,3 +43,115 @@ func (request) Set(r *http.Request, key, val any) *http.Request {
 func (request) Get(r *http.Request, key any) any {
 	return r.Context().Value(key)
 }
+
+var ErrRequestOption = sdk.Errorf("brock/sdkhttp: invalid request option")
+
+// NewRequest create the outbound request with the options of Header, Query,
+// Body and MultipartForm, or func(*http.Request) error for anything else.
+// The body is buffered so it can be retried by the Client and the
+// Content-Type is set unless given, the multipart body is streamed through a
+// pipe thus its error is returned when sending the request, such request
+// must be sent or have its body closed.
+//
+//	req, err := sdkhttp.NewRequest(ctx, "POST", "https://example.com/upload",
+//		sdkhttp.Header.WithKV("Authorization", "Bearer "+token),
+//		sdkhttp.Query.WithKV("dry_run", "true"),
+//		sdkhttp.MultipartForm.Field("name", "avatar"),
+//		sdkhttp.MultipartForm.File("file", "avatar.png", f),
+//	)
+//
+//nolint:cyclop
+func NewRequest(ctx context.Context, method, url string, opts ...any) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.URL.Query()
+	bodies, parts := make([]func() io.Reader, 0), make([]func(*multipart.Writer) error, 0)
+
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case nil:
+		case func(http.Header):
+			opt(req.Header)
+		case func(neturl.Values):
+			opt(query)
+		case func() io.Reader:
+			bodies = append(bodies, opt)
+		case func(*multipart.Writer) error:
+			parts = append(parts, opt)
+		case func(*multipart.Writer):
+			parts = append(parts, func(mw *multipart.Writer) error { opt(mw); return nil })
+		case func(*http.Request) error:
+			if err := opt(req); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, sdk.Errorf("%w: %T", ErrRequestOption, opt)
+		}
+	}
+
+	req.URL.RawQuery = query.Encode()
+
+	switch {
+	case len(bodies) > 0 && len(parts) > 0, len(bodies) > 1:
+		return nil, sdk.Errorf("%w: multiple body", ErrRequestOption)
+	case len(bodies) == 1:
+		if err := requestBody(req, bodies[0]()); err != nil {
+			return nil, err
+		}
+	case len(parts) > 0:
+		requestMultipart(req, parts)
+	}
+
+	return req, nil
+}
+
+func requestBody(req *http.Request, r io.Reader) error {
+	if r == nil {
+		return nil
+	}
+
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if req.Header.Get("Content-Type") == "" {
+		if ct, ok := r.(interface{ ContentType() string }); ok {
+			req.Header.Set("Content-Type", ct.ContentType())
+		} else {
+			req.Header.Set("Content-Type", http.DetectContentType(p))
+		}
+	}
+
+	req.ContentLength = int64(len(p))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(p)), nil }
+	req.Body, _ = req.GetBody()
+
+	return nil
+}
+
+func requestMultipart(req *http.Request, parts []func(*multipart.Writer) error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+	}
+
+	req.ContentLength, req.Body = -1, pr
+
+	go func() {
+		for _, part := range parts {
+			if err := part(mw); err != nil {
+				_ = pw.CloseWithError(err)
+
+				return
+			}
+		}
+
+		_ = pw.CloseWithError(mw.Close())
+	}()
+}
@@ -0,0 +1,69 @@
+package sdkhttp
+
+import (
+	"net/http"
+
+	"github.com/rs/xid"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+)
+
+// HeaderRequestID is the default header of the request ID.
+const HeaderRequestID = "X-Request-Id"
+
+// RequestIDConfiguration of the RequestID.
+type RequestIDConfiguration struct {
+	// Header to read and echo the request ID, default to X-Request-Id
+	Header string
+	// Generate the request ID when the request doesn't have the valid one,
+	// default to xid
+	Generate func() string
+}
+
+// RequestID read the request ID from the header or generate a new one, echo
+// it in the response and set it into the request context using the
+// sdkotel.RequestIDContext along with the child of sdkotel.Log that has the
+// request_id field. The Client and the sdkamqp.Publish propagate it from the
+// context.
+//
+//	http.Server{Handler: sdkhttp.RequestID(nil, mux)}
+//	sdkotel.Log(r.Context()).Info().Msg("has the request_id")
+//	sdkotel.RequestIDFromContext(r.Context())
+func RequestID(c *RequestIDConfiguration, h http.Handler) http.Handler {
+	c0 := RequestIDConfiguration{Header: HeaderRequestID, Generate: func() string { return xid.New().String() }}
+	if c != nil {
+		c0.Header = sdk.IfThenElse(c.Header != "", c.Header, c0.Header)
+		c0.Generate = sdk.IfThenElse(c.Generate != nil, c.Generate, c0.Generate)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(c0.Header)
+		if !requestIDValid(id) {
+			id = c0.Generate()
+		}
+
+		w.Header().Set(c0.Header, id)
+
+		ctx := sdkotel.RequestIDContext(r.Context(), id)
+		*r = *r.WithContext(sdkotel.Log(ctx).Child(map[string]any{"request_id": id}).Context(ctx))
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requestIDValid accept up to 128 visible ASCII characters, so the incoming
+// ID can't inject into the header or the log.
+func requestIDValid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,179 @@
+package sdkhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+	sdkotel "github.com/brick-io/brock/sdk/otel"
+)
+
+var ErrNotReady = sdk.Errorf("brock/sdkhttp: not ready")
+
+// ServeConfiguration of the Serve.
+type ServeConfiguration struct {
+	// Addr to listen, default to :8080
+	Addr string
+	// Listener replace the listening on the Addr
+	Listener net.Listener
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// Signals that start the shutdown, default to SIGINT and SIGTERM
+	Signals []os.Signal
+	// ShutdownDelay keep serving after the readiness fails so the load
+	// balancer stops routing before the listener is closed
+	ShutdownDelay time.Duration
+	// ShutdownTimeout of draining the in-flight requests and running the
+	// hooks, default to 30 seconds
+	ShutdownTimeout time.Duration
+	// OnShutdown hooks run in order after the draining, e.g. Tracer.Shutdown
+	OnShutdown []func(ctx context.Context) error
+
+	// LivenessPath default to /healthz, "-" to disable
+	LivenessPath string
+	// ReadinessPath default to /readyz, "-" to disable
+	ReadinessPath string
+	// Readiness checks run on every readiness request, e.g. db.PingContext
+	Readiness []func(ctx context.Context) error
+}
+
+// Serve the handler until the context is done or one of the Signals is
+// received, then fail the readiness, stop accepting, drain the in-flight
+// requests and run the OnShutdown hooks within the ShutdownTimeout, the
+// second signal force quit. The liveness and readiness endpoints are
+// answered before the handler unless disabled.
+//
+//	err := sdkhttp.Serve(ctx, &sdkhttp.ServeConfiguration{
+//		Addr:       ":8080",
+//		Readiness:  []func(context.Context) error{db.PingContext},
+//		OnShutdown: []func(context.Context) error{
+//			tracer.Shutdown,
+//			func(context.Context) error { return db.Close() },
+//		},
+//	}, mux)
+func Serve(ctx context.Context, c *ServeConfiguration, h http.Handler) error {
+	c0 := new(ServeConfiguration)
+	if c != nil {
+		c0 = c
+	}
+
+	signals := sdk.IfThenElse(len(c0.Signals) > 0, c0.Signals, []os.Signal{os.Interrupt, syscall.SIGTERM})
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+
+	defer stop()
+
+	ln := c0.Listener
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", sdk.IfThenElse(c0.Addr != "", c0.Addr, ":8080")); err != nil {
+			return err
+		}
+	}
+
+	ready := new(atomic.Bool)
+	ready.Store(true)
+
+	srv := &http.Server{
+		Handler:           serveHealth(c0, ready, h),
+		ReadHeaderTimeout: c0.ReadHeaderTimeout,
+		ReadTimeout:       c0.ReadTimeout,
+		WriteTimeout:      c0.WriteTimeout,
+		IdleTimeout:       c0.IdleTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+
+	log := sdkotel.Log(ctx)
+	log.Info().Str("addr", ln.Addr().String()).Msg("brock/sdkhttp: serving")
+
+	errs := make(sdk.Errors, 0)
+
+	select {
+	case err := <-errCh:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		// restore the default behavior so the second signal force quit
+		stop()
+		ready.Store(false)
+		log.Info().Msg("brock/sdkhttp: shutting down")
+
+		if c0.ShutdownDelay > 0 {
+			time.Sleep(c0.ShutdownDelay)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		sdk.IfThenElse(c0.ShutdownTimeout > 0, c0.ShutdownTimeout, 30*time.Second))
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, hook := range c0.OnShutdown {
+		if err := hook(shutdownCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = errs.Filter(func(err error) bool { return err != nil && !errors.Is(err, http.ErrServerClosed) })
+	if len(errs) > 0 {
+		log.Error().Err(errs).Msg("brock/sdkhttp: shutdown")
+
+		return errs
+	}
+
+	return nil
+}
+
+// serveHealth answer the liveness as long as the server is running, and the
+// readiness until the shutdown starts or one of the checks fails.
+func serveHealth(c *ServeConfiguration, ready *atomic.Bool, h http.Handler) http.Handler {
+	liveness := sdk.IfThenElse(c.LivenessPath != "", c.LivenessPath, "/healthz")
+	readiness := sdk.IfThenElse(c.ReadinessPath != "", c.ReadinessPath, "/readyz")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		switch path := r.URL.Path; {
+		default:
+			h.ServeHTTP(w, r)
+		case liveness != "-" && path == liveness:
+			http.Error(w, http.StatusText(http.StatusOK), http.StatusOK)
+		case readiness != "-" && path == readiness:
+			err := error(nil)
+			if !ready.Load() {
+				err = ErrNotReady
+			}
+
+			for i := 0; err == nil && i < len(c.Readiness); i++ {
+				err = c.Readiness[i](r.Context())
+			}
+
+			if err != nil {
+				sdkotel.Log(r.Context()).Warn().Err(err).Msg("brock/sdkhttp: readiness")
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusOK), http.StatusOK)
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package sdkhttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+var ErrSSEClosed = sdk.Errorf("brock/sdkhttp: sse already closed")
+
+// SSEEvent is the server-sent event, the Data is framed per line.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// SSEReplay keep the recent events so the reconnecting client could resume
+// from the Last-Event-ID, it's shared across the connections thus filled by
+// the publisher rather than by SSEWriter.Send.
+type SSEReplay interface {
+	// Append the event that has an ID
+	Append(e SSEEvent)
+	// Since return the events after the id, ok is false when the id is unknown
+	Since(id string) (events []SSEEvent, ok bool)
+}
+
+// SSEConfiguration of the SSE.
+type SSEConfiguration struct {
+	// Heartbeat is the interval of the comment line that keep the connection
+	// alive, default to 15 seconds, negative to disable.
+	Heartbeat time.Duration
+	// Retry is the reconnection time sent to the client on connect
+	Retry time.Duration
+	// Replay is used to resume from the Last-Event-ID header
+	Replay SSEReplay
+}
+
+// SSEWriter write the server-sent events, it's safe for concurrent use.
+type SSEWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	f    http.Flusher
+	ctx  context.Context
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// SSE start the text/event-stream response using WrapHandler.Stream, then
+// replay the events after the Last-Event-ID and keep sending the heartbeat
+// until the client disconnect or Close is called.
+//
+//	sse, err := sdkhttp.SSE(w, r, &sdkhttp.SSEConfiguration{Replay: replay})
+//	if err != nil {
+//		return
+//	}
+//	defer sse.Close()
+//
+//	for {
+//		select {
+//		case <-sse.Done():
+//			return
+//		case e := <-events:
+//			_ = sse.Send(e)
+//		}
+//	}
+func SSE(w http.ResponseWriter, r *http.Request, c ...*SSEConfiguration) (*SSEWriter, error) {
+	c0 := new(SSEConfiguration)
+	if len(c) > 0 && c[0] != nil {
+		c0 = c[0]
+	}
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+
+	for k, v := range map[string]string{
+		"Content-Type":      "text/event-stream",
+		"Cache-Control":     "no-cache",
+		"Connection":        "keep-alive",
+		"X-Accel-Buffering": "no",
+	} {
+		w.Header().Set(k, v)
+	}
+
+	buf := new(bytes.Buffer)
+	if c0.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(c0.Retry.Milliseconds(), 10) + "\n\n")
+	} else {
+		buf.WriteString(": connected\n\n")
+	}
+
+	if id := r.Header.Get("Last-Event-ID"); id != "" && c0.Replay != nil {
+		events, _ := c0.Replay.Since(id)
+		for _, e := range events {
+			sseFrame(buf, e)
+		}
+	}
+
+	if _, err := Wrap.Handler(w, r).Stream(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	x := &SSEWriter{w: w, f: f, ctx: r.Context(), stop: make(chan struct{})}
+
+	heartbeat := c0.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = 15 * time.Second
+	}
+
+	if heartbeat > 0 {
+		x.wg.Add(1)
+
+		go x.heartbeat(heartbeat)
+	}
+
+	return x, nil
+}
+
+// Send the event, it returns the context error when the client already
+// disconnected or ErrSSEClosed after Close.
+func (x *SSEWriter) Send(e SSEEvent) error {
+	buf := new(bytes.Buffer)
+	sseFrame(buf, e)
+
+	return x.write(buf.Bytes())
+}
+
+// Done is closed when the client disconnected.
+func (x *SSEWriter) Done() <-chan struct{} { return x.ctx.Done() }
+
+// Close stop the heartbeat, the response is ended when the handler returns.
+func (x *SSEWriter) Close() {
+	x.once.Do(func() { close(x.stop) })
+	x.wg.Wait()
+}
+
+func (x *SSEWriter) heartbeat(interval time.Duration) {
+	defer x.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-x.ctx.Done():
+			return
+		case <-x.stop:
+			return
+		case <-ticker.C:
+			if x.write([]byte(": heartbeat\n\n")) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (x *SSEWriter) write(p []byte) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	select {
+	case <-x.ctx.Done():
+		return x.ctx.Err()
+	case <-x.stop:
+		return ErrSSEClosed
+	default:
+	}
+
+	if _, err := x.w.Write(p); err != nil {
+		return err
+	}
+
+	x.f.Flush()
+
+	return nil
+}
+
+// sseFrame write the event into the buffer, the CR and LF in the id and
+// event are dropped as they would break the framing.
+func sseFrame(buf *bytes.Buffer, e SSEEvent) {
+	field := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\n")
+	}
+
+	clean := strings.NewReplacer("\r", "", "\n", "", "\x00", "")
+
+	if e.ID != "" {
+		field("id", clean.Replace(e.ID))
+	}
+
+	if e.Event != "" {
+		field("event", clean.Replace(e.Event))
+	}
+
+	if e.Retry > 0 {
+		field("retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+
+	data := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(e.Data)
+	for _, line := range strings.Split(data, "\n") {
+		field("data", line)
+	}
+
+	buf.WriteString("\n")
+}
+
+// SSEMemoryReplay keep the last size events in memory.
+func SSEMemoryReplay(size int) SSEReplay {
+	return &sseMemoryReplay{size: size}
+}
+
+type sseMemoryReplay struct {
+	mu     sync.RWMutex
+	size   int
+	events []SSEEvent
+}
+
+func (x *sseMemoryReplay) Append(e SSEEvent) {
+	if e.ID == "" || x.size < 1 {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.events = append(x.events, e)
+	if len(x.events) > x.size {
+		x.events = append(x.events[:0:0], x.events[len(x.events)-x.size:]...)
+	}
+}
+
+func (x *sseMemoryReplay) Since(id string) ([]SSEEvent, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	for i := range x.events {
+		if x.events[i].ID == id {
+			return append([]SSEEvent(nil), x.events[i+1:]...), true
+		}
+	}
+
+	return nil, false
+}
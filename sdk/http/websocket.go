@@ -0,0 +1,531 @@
+package sdkhttp
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/brick-io/brock/sdk"
+)
+
+var (
+	ErrWebSocketHandshake     = sdk.Errorf("brock/sdkhttp: websocket: bad handshake")
+	ErrWebSocketProtocol      = sdk.Errorf("brock/sdkhttp: websocket: protocol error")
+	ErrWebSocketMessageTooBig = sdk.Errorf("brock/sdkhttp: websocket: message too big")
+	ErrWebSocketClosed        = sdk.Errorf("brock/sdkhttp: websocket: closed")
+)
+
+// The message type of the WebSocket.
+const (
+	WebSocketText   = 1
+	WebSocketBinary = 2
+)
+
+// The close code of the WebSocket, see RFC 6455 section 7.4.1.
+const (
+	WebSocketCloseNormal          = 1000
+	WebSocketCloseGoingAway       = 1001
+	WebSocketCloseProtocolError   = 1002
+	WebSocketCloseUnsupportedData = 1003
+	WebSocketCloseNoStatus        = 1005
+	WebSocketCloseInvalidPayload  = 1007
+	WebSocketClosePolicyViolation = 1008
+	WebSocketCloseMessageTooBig   = 1009
+	WebSocketCloseInternalError   = 1011
+)
+
+const (
+	webSocketGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	webSocketContinuation = 0
+	webSocketClose        = 8
+	webSocketPing         = 9
+	webSocketPong         = 10
+)
+
+// WebSocketCloseError is returned by the read after the close frame.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (err *WebSocketCloseError) Error() string {
+	return ErrWebSocketClosed.Error() + ": " + strconv.Itoa(err.Code) + " " + err.Reason
+}
+
+func (err *WebSocketCloseError) Is(target error) bool { return target == ErrWebSocketClosed }
+
+// WebSocketConfiguration of the WebSocket.
+type WebSocketConfiguration struct {
+	// ReadLimit is the maximum bytes of a message, default to 1 MiB
+	ReadLimit int64
+	// PingInterval is the interval of the ping, the connection without any
+	// frame received for twice of it is considered dead, default to 30
+	// seconds, negative to disable.
+	PingInterval time.Duration
+	// WriteTimeout of each frame, default to 10 seconds
+	WriteTimeout time.Duration
+	// Subprotocols supported by the server in the order of preference
+	Subprotocols []string
+	// CheckOrigin allow the request, default to allow the request without
+	// Origin or with Origin that has the same host as the request.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// WebSocketConn is the server side of the WebSocket connection, the read
+// methods are not safe for concurrent use while the write methods are.
+type WebSocketConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	cfg  WebSocketConfiguration
+
+	// Subprotocol negotiated during the handshake
+	Subprotocol string
+
+	wmu       sync.Mutex
+	reading   int32
+	closeSent bool
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// WebSocket upgrade the request into the WebSocket connection by hijacking
+// the http.ResponseWriter, the failed handshake is responded with 4xx.
+//
+//	ws, err := sdkhttp.WebSocket(w, r)
+//	if err != nil {
+//		return
+//	}
+//	defer ws.Close(sdkhttp.WebSocketCloseNormal, "")
+//
+//	for {
+//		var msg message
+//		if err := ws.ReadJSON(&msg); err != nil {
+//			return
+//		}
+//		_ = ws.WriteJSON(reply(msg))
+//	}
+//
+//nolint:cyclop
+func WebSocket(w http.ResponseWriter, r *http.Request, c ...*WebSocketConfiguration) (*WebSocketConn, error) {
+	cfg := WebSocketConfiguration{ReadLimit: 1 << 20, PingInterval: 30 * time.Second, WriteTimeout: 10 * time.Second}
+	if len(c) > 0 && c[0] != nil {
+		cfg.ReadLimit = sdk.IfThenElse(c[0].ReadLimit > 0, c[0].ReadLimit, cfg.ReadLimit)
+		cfg.PingInterval = sdk.IfThenElse(c[0].PingInterval != 0, c[0].PingInterval, cfg.PingInterval)
+		cfg.WriteTimeout = sdk.IfThenElse(c[0].WriteTimeout > 0, c[0].WriteTimeout, cfg.WriteTimeout)
+		cfg.Subprotocols, cfg.CheckOrigin = c[0].Subprotocols, c[0].CheckOrigin
+	}
+
+	fail := func(code int, msg string) (*WebSocketConn, error) {
+		if code == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+
+		http.Error(w, http.StatusText(code), code)
+		*r = *(Request.Set(r, ctxKeyMiddlewareAlreadySent{}, sdk.NonNil))
+
+		return nil, sdk.Errorf("%w: %s", ErrWebSocketHandshake, msg)
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	switch p, err := base64.StdEncoding.DecodeString(key); {
+	case r.Method != http.MethodGet:
+		return fail(http.StatusMethodNotAllowed, "method is not GET")
+	case !webSocketHasToken(r.Header, "Connection", "upgrade"):
+		return fail(http.StatusBadRequest, "missing Connection: upgrade")
+	case !webSocketHasToken(r.Header, "Upgrade", "websocket"):
+		return fail(http.StatusBadRequest, "missing Upgrade: websocket")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return fail(http.StatusUpgradeRequired, "unsupported version")
+	case err != nil || len(p) != 16:
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	case !sdk.IfThenElse(cfg.CheckOrigin == nil, webSocketSameOrigin, cfg.CheckOrigin)(r):
+		return fail(http.StatusForbidden, "origin not allowed")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	*r = *(Request.Set(r, ctxKeyMiddlewareAlreadySent{}, sdk.NonNil))
+
+	x := &WebSocketConn{conn: conn, br: brw.Reader, cfg: cfg, closed: make(chan struct{})}
+	x.Subprotocol = webSocketSubprotocol(r.Header, cfg.Subprotocols)
+
+	sum := sha1.Sum([]byte(key + webSocketGUID)) //nolint:gosec
+	res := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n"
+
+	if x.Subprotocol != "" {
+		res += "Sec-WebSocket-Protocol: " + x.Subprotocol + "\r\n"
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	if _, err = brw.WriteString(res + "\r\n"); err == nil {
+		err = brw.Flush()
+	}
+
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	x.extendReadDeadline()
+
+	if cfg.PingInterval > 0 {
+		go x.ping()
+	}
+
+	return x, nil
+}
+
+// ReadMessage read the next text or binary message, the ping is answered
+// and the valid close frame is replied with 1000 then returned as
+// *WebSocketCloseError, while the invalid close code fails with 1002.
+//
+//nolint:cyclop,funlen
+func (x *WebSocketConn) ReadMessage() (int, []byte, error) {
+	atomic.StoreInt32(&x.reading, 1)
+	defer atomic.StoreInt32(&x.reading, 0)
+
+	typ, msg := 0, make([]byte, 0)
+
+	for {
+		fin, opcode, p, err := x.readFrame()
+		if err != nil {
+			x.closeConn()
+
+			return 0, nil, err
+		}
+
+		x.extendReadDeadline()
+
+		switch opcode {
+		case webSocketPing:
+			_ = x.writeFrame(webSocketPong, p)
+
+			continue
+		case webSocketPong:
+			continue
+		case webSocketClose:
+			err := &WebSocketCloseError{Code: WebSocketCloseNoStatus}
+			if len(p) >= 2 {
+				err.Code, err.Reason = int(binary.BigEndian.Uint16(p)), string(p[2:])
+			}
+
+			switch {
+			case len(p) == 1, len(p) >= 2 && !webSocketCloseCodeValid(err.Code):
+				return 0, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "invalid close code")
+			case !utf8.ValidString(err.Reason):
+				return 0, nil, x.fail(WebSocketCloseInvalidPayload, ErrWebSocketProtocol, "invalid utf-8")
+			}
+
+			_ = x.writeClose(WebSocketCloseNormal, "")
+			x.closeConn()
+
+			return 0, nil, err
+		case webSocketContinuation:
+			if typ == 0 {
+				return 0, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "unexpected continuation")
+			}
+		case WebSocketText, WebSocketBinary:
+			if typ != 0 {
+				return 0, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "expected continuation")
+			}
+
+			typ = int(opcode)
+		default:
+			return 0, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "unknown opcode")
+		}
+
+		if int64(len(msg))+int64(len(p)) > x.cfg.ReadLimit {
+			return 0, nil, x.fail(WebSocketCloseMessageTooBig, ErrWebSocketMessageTooBig, "")
+		}
+
+		msg = append(msg, p...)
+
+		if !fin {
+			continue
+		}
+
+		if typ == WebSocketText && !utf8.Valid(msg) {
+			return 0, nil, x.fail(WebSocketCloseInvalidPayload, ErrWebSocketProtocol, "invalid utf-8")
+		}
+
+		return typ, msg, nil
+	}
+}
+
+// WriteMessage write the text or binary message as a single frame.
+func (x *WebSocketConn) WriteMessage(typ int, p []byte) error {
+	if typ != WebSocketText && typ != WebSocketBinary {
+		return sdk.Errorf("%w: invalid message type %d", ErrWebSocketProtocol, typ)
+	}
+
+	return x.writeFrame(byte(typ), p)
+}
+
+// ReadJSON read the next message and unmarshal it using sdk.JSON.
+func (x *WebSocketConn) ReadJSON(v any) error {
+	_, p, err := x.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return sdk.JSON.Unmarshal(p, v)
+}
+
+// WriteJSON marshal the value using sdk.JSON and write it as text message.
+func (x *WebSocketConn) WriteJSON(v any) error {
+	p, err := sdk.JSON.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return x.WriteMessage(WebSocketText, p)
+}
+
+// Close start the close handshake then close the connection after the peer
+// replied or a second has passed.
+func (x *WebSocketConn) Close(code int, reason string) error {
+	err := x.writeClose(code, reason)
+
+	_ = x.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	if atomic.LoadInt32(&x.reading) == 0 {
+		for {
+			if _, _, err := x.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}
+
+	select {
+	case <-x.closed:
+	case <-time.After(time.Second):
+	}
+
+	x.closeConn()
+
+	return err
+}
+
+// Done is closed when the connection is closed.
+func (x *WebSocketConn) Done() <-chan struct{} { return x.closed }
+
+func (x *WebSocketConn) ping() {
+	ticker := time.NewTicker(x.cfg.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-x.closed:
+			return
+		case <-ticker.C:
+			if x.writeFrame(webSocketPing, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+// extendReadDeadline unless the close frame is sent, so the close
+// handshake is bounded by Close.
+func (x *WebSocketConn) extendReadDeadline() {
+	x.wmu.Lock()
+	defer x.wmu.Unlock()
+
+	if x.cfg.PingInterval > 0 && !x.closeSent {
+		_ = x.conn.SetReadDeadline(time.Now().Add(2 * x.cfg.PingInterval))
+	}
+}
+
+// webSocketCloseCodeValid report whether the peer may send the close code,
+// the 1005, 1006 and 1015 are reserved for the local use, see RFC 6455
+// section 7.4.
+func webSocketCloseCodeValid(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+
+	return false
+}
+
+func (x *WebSocketConn) fail(code int, err error, msg string) error {
+	_ = x.writeClose(code, msg)
+	x.closeConn()
+
+	return sdk.IfThenElse(msg == "", err, sdk.Errorf("%w: %s", err, msg))
+}
+
+func (x *WebSocketConn) closeConn() {
+	x.closeOnce.Do(func() {
+		_ = x.conn.Close()
+		close(x.closed)
+	})
+}
+
+func (x *WebSocketConn) writeClose(code int, reason string) error {
+	p := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(p, uint16(code))
+
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+
+	return x.writeFrame(webSocketClose, append(p, reason...))
+}
+
+// writeFrame write the unmasked final frame, nothing is written after the
+// close frame.
+func (x *WebSocketConn) writeFrame(opcode byte, p []byte) error {
+	x.wmu.Lock()
+	defer x.wmu.Unlock()
+
+	if x.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+
+	switch n := len(p); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	_ = x.conn.SetWriteDeadline(time.Now().Add(x.cfg.WriteTimeout))
+	if _, err := x.conn.Write(append(header, p...)); err != nil {
+		return err
+	}
+
+	x.closeSent = opcode == webSocketClose
+
+	return nil
+}
+
+// readFrame read a single frame, the client frame must be masked.
+func (x *WebSocketConn) readFrame() (fin bool, opcode byte, p []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(x.br, header); err != nil {
+		return
+	}
+
+	fin, opcode, masked := header[0]&0x80 != 0, header[0]&0x0f, header[1]&0x80 != 0
+	n := uint64(header[1] & 0x7f)
+
+	switch {
+	case header[0]&0x70 != 0:
+		return fin, opcode, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "reserved bits are set")
+	case !masked:
+		return fin, opcode, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "frame is not masked")
+	case opcode >= webSocketClose && (!fin || n > 125):
+		return fin, opcode, nil, x.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol, "invalid control frame")
+	}
+
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(x.br, ext); err != nil {
+			return
+		}
+
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(x.br, ext); err != nil {
+			return
+		}
+
+		n = binary.BigEndian.Uint64(ext)
+	}
+
+	if n > uint64(x.cfg.ReadLimit) {
+		return fin, opcode, nil, x.fail(WebSocketCloseMessageTooBig, ErrWebSocketMessageTooBig, "")
+	}
+
+	mask := make([]byte, 4)
+	if _, err = io.ReadFull(x.br, mask); err != nil {
+		return
+	}
+
+	p = make([]byte, n)
+	if _, err = io.ReadFull(x.br, p); err != nil {
+		return
+	}
+
+	for i := range p {
+		p[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, p, nil
+}
+
+func webSocketHasToken(header http.Header, key, token string) bool {
+	for _, v := range header.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func webSocketSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	_, host, ok := strings.Cut(origin, "://")
+
+	return ok && strings.EqualFold(host, r.Host)
+}
+
+func webSocketSubprotocol(header http.Header, supported []string) string {
+	requested := make(map[string]bool)
+
+	for _, v := range header.Values("Sec-WebSocket-Protocol") {
+		for _, s := range strings.Split(v, ",") {
+			requested[strings.TrimSpace(s)] = true
+		}
+	}
+
+	for _, s := range supported {
+		if requested[s] {
+			return s
+		}
+	}
+
+	return ""
+}
@@ -3,7 +3,11 @@ package sdkhttp
 import (
 	"bytes"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/brick-io/brock/sdk"
 )
@@ -12,6 +16,7 @@ var (
 	ErrAlreadySent     = sdk.Errorf("brock/sdkhttp: already sent to the client")
 	ErrAlreadyStreamed = sdk.Errorf("brock/sdkhttp: already streamed to the client")
 	ErrUnimplemented   = sdk.Errorf("brock/sdkhttp: unimplemented")
+	ErrNotAcceptable   = sdk.Errorf("brock/sdkhttp: not acceptable")
 )
 
 type (
@@ -25,21 +30,31 @@ var Wrap wrap
 
 type wrap struct{}
 
-// Middleware multiple handlers as one http.Handler.
+// Middleware multiple handlers as one http.Handler, when the chain ends
+// without sending any response the error passed via WrapHandler.Next is sent
+// as application/problem+json, see WrapHandler.Problem.
 func (wrap) Middleware(handlers ...http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+
 		for _, h := range handlers {
 			if h == nil {
 				continue
 			}
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(rw, r)
 
 			if Request.IsCancelled(r) {
-				break
+				return
 			} else if Request.Get(r, ctxKeyMiddlewareAlreadySent{}) != nil {
-				break
+				return
 			}
 		}
+
+		// the handler may have written directly, e.g. using http.Error
+		if Request.Get(r, ctxKeyMiddlewareAlreadyStreamed{}) == nil && rw.status == 0 && rw.written == 0 {
+			wr := Wrap.Handler(rw, r)
+			_, _ = wr.Problem(wr.Err())
+		}
 	})
 }
 
@@ -51,6 +66,15 @@ type WrapHandler interface {
 	Next(err error)
 	// Send is a shorthand for set the statusCode, header & body
 	Send(statusCode int, header http.Header, body io.Reader) (int, error)
+	// Render marshal the value into the format negotiated from the Accept header
+	Render(statusCode int, v any) (int, error)
+	// Bind the request into dst, on failure the error is sent as the problem
+	Bind(dst any) error
+	// Problem send the error as application/problem+json
+	Problem(err error) (int, error)
+	// Precondition set the validators and send the 304 or 412 when the
+	// conditional request fails
+	Precondition(etag string, lastModified time.Time) bool
 	// Stream is used for streaming response to the client
 	Stream(p []byte) (int, error)
 	// H2Push initiate a HTTP/2 server push
@@ -109,6 +133,32 @@ func (x *handler) Send(statusCode int, header http.Header, body io.Reader) (int,
 	return int(n), err
 }
 
+// Render marshal the value as JSON, XML, YAML or TOML based on the Accept
+// header of the request, JSON is used when there is no preference. When none
+// of them is acceptable the 406 is sent and ErrNotAcceptable is returned,
+// the marshal error is returned as is so it can be passed to Next.
+func (x *handler) Render(statusCode int, v any) (int, error) {
+	header := Header.Create(Header.WithKV("Vary", "Accept"))
+
+	format, ok := negotiate(x.r.Header.Values("Accept"))
+	if !ok {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		code := http.StatusNotAcceptable
+		_, err := x.Send(code, header, strings.NewReader(http.StatusText(code)+"\n"))
+
+		return 0, sdk.IfThenElse(err != nil, err, ErrNotAcceptable)
+	}
+
+	p, err := format.Parser.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+
+	header.Set("Content-Type", format.ContentType+"; charset=utf-8")
+
+	return x.Send(statusCode, header, bytes.NewReader(p))
+}
+
 // Stream is used for streaming response to the client.
 func (x *handler) Stream(p []byte) (int, error) {
 	if len(p) < 1 {
@@ -157,3 +207,68 @@ func (x *handler) H2Push(target, method string, header http.Header) error {
 
 	return w.Push(target, opts)
 }
+
+type renderFormat struct {
+	ContentType string
+	Parser      sdk.Parser
+	// Aliases of the ContentType that also accepted
+	Aliases []string
+}
+
+//nolint:gochecknoglobals
+var renderFormats = []renderFormat{
+	{"application/json", sdk.JSON, nil},
+	{"application/xml", sdk.XML, []string{"text/xml"}},
+	{"application/yaml", sdk.YAML, []string{"application/x-yaml", "text/yaml"}},
+	{"application/toml", sdk.TOML, nil},
+}
+
+// negotiate pick the format which has the highest quality value of the most
+// specific matching media range, ties are resolved by the renderFormats order.
+func negotiate(accepts []string) (renderFormat, bool) {
+	ranges := make(map[string]float64)
+
+	for _, accept := range accepts {
+		for _, s := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+			if err != nil {
+				continue
+			}
+
+			q, err := strconv.ParseFloat(sdk.IfThenElse(params["q"] == "", "1", params["q"]), 64)
+			if err != nil {
+				continue
+			}
+
+			ranges[mediaType] = q
+		}
+	}
+
+	if len(ranges) < 1 {
+		return renderFormats[0], true
+	}
+
+	best, bestQ := renderFormat{}, 0.0
+
+	for _, format := range renderFormats {
+		q := -1.0
+
+		for _, contentType := range append([]string{format.ContentType}, format.Aliases...) {
+			typ, _, _ := strings.Cut(contentType, "/")
+
+			for _, mediaRange := range []string{contentType, typ + "/*", "*/*"} {
+				if v, ok := ranges[mediaRange]; ok {
+					q = sdk.IfThenElse(q < 0 || mediaRange == contentType, v, q)
+
+					break
+				}
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+
+	return best, bestQ > 0
+}
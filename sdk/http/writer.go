@@ -0,0 +1,72 @@
+package sdkhttp
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseWriter record the status code and the size of the response while
+// keeping the optional interfaces of the wrapped http.ResponseWriter.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+
+	return n, err
+}
+
+// Status of the response, http.StatusOK when nothing is written.
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return ErrUnimplemented
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := h.Hijack()
+		if err == nil && w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+
+		return conn, rw, err
+	}
+
+	return nil, nil, ErrUnimplemented
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -28,6 +28,17 @@ func (attr) KeyValueHTTPRequest(request *http.Request) []attribute.KeyValue {
 	return kvs
 }
 
+func (attr) KeyValueHTTPClientRequest(request *http.Request) []attribute.KeyValue {
+	return semconv.HTTPClientAttributesFromHTTPRequest(request)
+}
+
+func (attr) KeyValueHTTPResponse(statusCode int, size int64) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.HTTPStatusCodeKey.Int(statusCode),
+		semconv.HTTPResponseContentLengthKey.Int64(size),
+	}
+}
+
 type code struct{}
 
 func (code) StatusUnset() codes.Code { return codes.Unset }
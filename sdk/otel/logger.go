@@ -57,6 +57,14 @@ func (l *Logger) Context(ctx context.Context) context.Context {
 	return context.WithValue(ctx, ctx_key_logger{}, l)
 }
 
+// Child create the logger that carries the fields on every line, e.g. the
+// request ID, put it into the context using Logger.Context.
+func (l *Logger) Child(fields map[string]any) *Logger {
+	z := l.Logger.With().Fields(fields).Logger()
+
+	return &Logger{&z, log.New(&z, "", log.LstdFlags), &logrus.Logger{Out: &z}}
+}
+
 func (x *Logger) ParseLevel(level string) (zerolog.Level, logrus.Level) {
 	level = strings.ToLower(level)
 	z, _ := zerolog.ParseLevel(level)
@@ -0,0 +1,20 @@
+package sdkotel
+
+import "context"
+
+type requestIDCtxKey struct{}
+
+// RequestIDContext put the request ID into the context, it's set by the
+// sdkhttp.RequestID and propagated by the sdkhttp.Client and the
+// sdkamqp.Publish.
+func RequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDFromContext extract the request ID set by the RequestIDContext,
+// it's empty outside of the request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+
+	return id
+}
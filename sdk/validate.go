@@ -0,0 +1,286 @@
+package sdk
+
+import (
+	"errors"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrValidation     = Errorf("brock/sdk: validation failed")
+	ErrValidationRule = Errorf("brock/sdk: invalid validation rule")
+)
+
+// FieldError is the error of the field that violate the rule.
+type FieldError struct {
+	// Field is the path of the Go struct field, e.g. Address.City or Tags[1]
+	Field string
+	// Rule is the name of the violated rule, e.g. min
+	Rule string
+	// Param is the parameter of the rule, e.g. 3 on min=3
+	Param string
+}
+
+func (err *FieldError) Error() string {
+	msg := ""
+
+	switch err.Rule {
+	case "required":
+		msg = "is required"
+	case "min":
+		msg = "must be at least " + err.Param
+	case "max":
+		msg = "must be at most " + err.Param
+	case "len":
+		msg = "length must be " + err.Param
+	case "email":
+		msg = "must be a valid email address"
+	case "oneof":
+		msg = "must be one of [" + err.Param + "]"
+	case "regex":
+		msg = "must match " + err.Param
+	}
+
+	return err.Field + " " + msg
+}
+
+func (err *FieldError) Is(target error) bool { return target == ErrValidation }
+
+// Validate the struct fields based on the `validate` tag, the nested struct
+// is always validated while the elements of slice, array and map are only
+// validated after the dive rule. The rules are separated by comma:
+//
+//	required  the value must not be zero, nil or empty
+//	omitempty the zero, nil or empty value skip the rest of the rules
+//	min=n     the number must be >= n, or the length must be >= n
+//	max=n     the number must be <= n, or the length must be <= n
+//	len=n     the length of string (in runes), slice, array or map must be n
+//	email     the string must be a bare email address
+//	oneof=a b the value must be one of the space separated values
+//	regex=re  the string must match the re, it takes the rest of the tag
+//	dive      the following rules are applied to each element
+//
+// The rules are applied to the zero value as well unless omitempty, the nil
+// pointer violate the rules. The error is either nil, the ErrValidationRule
+// on misuse of the rule e.g. unknown rule or min on bool, or Errors of
+// *FieldError.
+//
+//	type input struct {
+//		Name  string   `validate:"required,min=3,max=32"`
+//		Email string   `validate:"required,email"`
+//		Age   int      `validate:"omitempty,min=18"`
+//		Role  string   `validate:"oneof=admin member"`
+//		Tags  []string `validate:"max=5,dive,required,regex=^[a-z]+$"`
+//	}
+func Validate(v any) error {
+	errs := validateValue(reflect.ValueOf(v), "", "")
+
+	for _, err := range errs {
+		if errors.Is(err, ErrValidationRule) {
+			return err
+		}
+	}
+
+	return IfThenElse[error](len(errs) < 1, nil, errs)
+}
+
+//nolint:gochecknoglobals
+var validateRegexps sync.Map
+
+func validateValue(v reflect.Value, field, tag string) Errors {
+	errs := make(Errors, 0)
+
+	for rules := tag; ; {
+		var rule string
+
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else {
+			rule, rules, _ = strings.Cut(rules, ",")
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "":
+		case "dive":
+			return append(errs, validateDive(v, field, rules)...)
+		case "required":
+			if validateEmpty(v) {
+				return append(errs, &FieldError{Field: field, Rule: name})
+			}
+		case "omitempty":
+			if validateEmpty(v) {
+				return errs
+			}
+		default:
+			ok, err := validateRule(reflect.Indirect(v), name, param)
+			if err != nil {
+				return append(errs, Errorf("%w: %s: %s", ErrValidationRule, field, err.Error()))
+			} else if !ok {
+				errs = append(errs, &FieldError{Field: field, Rule: name, Param: param})
+			}
+		}
+
+		if rules == "" {
+			break
+		}
+	}
+
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}) {
+		errs = append(errs, validateStruct(v, IfThenElse(field == "", "", field+"."))...)
+	}
+
+	return errs
+}
+
+func validateStruct(v reflect.Value, prefix string) Errors {
+	errs := make(Errors, 0)
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+
+		field := IfThenElse(f.Anonymous && tag == "", strings.TrimSuffix(prefix, "."), prefix+f.Name)
+		errs = append(errs, validateValue(v.Field(i), field, tag)...)
+	}
+
+	return errs
+}
+
+func validateDive(v reflect.Value, field, tag string) Errors {
+	errs := make(Errors, 0)
+	v = reflect.Indirect(v)
+
+	switch v.Kind() {
+	default:
+		return append(errs, Errorf("%w: %s: dive: unsupported type: %s", ErrValidationRule, field, v.Type()))
+	case reflect.Invalid:
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, validateValue(v.Index(i), field+"["+strconv.Itoa(i)+"]", tag)...)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			errs = append(errs, validateValue(iter.Value(), field+"["+Sprint(iter.Key().Interface())+"]", tag)...)
+		}
+	}
+
+	return errs
+}
+
+// validateEmpty report whether the value is zero, nil or empty.
+func validateEmpty(v reflect.Value) bool {
+	return !v.IsValid() || v.IsZero() || validateLen(v) == 0
+}
+
+// validateLen return the length of the value or -1 when it doesn't have one.
+func validateLen(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String())
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return v.Len()
+	}
+
+	return -1
+}
+
+// validateRule report whether the value satisfy the rule, the nil pointer
+// doesn't satisfy any rule.
+//
+//nolint:cyclop
+func validateRule(v reflect.Value, name, param string) (bool, error) {
+	switch name {
+	case "min", "max", "len":
+		if !v.IsValid() {
+			return false, nil
+		}
+
+		return validateCompare(v, name, param)
+	case "email":
+		if !v.IsValid() || v.Kind() != reflect.String {
+			return false, nil
+		}
+
+		addr, err := mail.ParseAddress(v.String())
+
+		return err == nil && addr.Address == v.String(), nil
+	case "oneof":
+		if !v.IsValid() {
+			return false, nil
+		}
+
+		s := Sprint(v.Interface())
+		for _, each := range strings.Fields(param) {
+			if s == each {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case "regex":
+		re, ok := validateRegexps.Load(param)
+		if !ok {
+			compiled, err := regexp.Compile(param)
+			if err != nil {
+				return false, Errorf("regex: %w", err)
+			}
+
+			re, _ = validateRegexps.LoadOrStore(param, compiled)
+		}
+
+		return v.IsValid() && v.Kind() == reflect.String && re.(*regexp.Regexp).MatchString(v.String()), nil //nolint:forcetypeassert
+	}
+
+	return false, Errorf("unknown rule: %s", name)
+}
+
+func validateCompare(v reflect.Value, name, param string) (bool, error) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false, Errorf("%s: invalid param: %s", name, param)
+	}
+
+	var x float64
+
+	switch l := validateLen(v); {
+	case l >= 0:
+		x = float64(l)
+	case v.CanInt():
+		x = float64(v.Int())
+	case v.CanUint():
+		x = float64(v.Uint())
+	case v.CanFloat():
+		x = v.Float()
+	default:
+		return false, Errorf("%s: unsupported type: %s", name, v.Type())
+	}
+
+	switch name {
+	case "min":
+		return x >= n, nil
+	case "max":
+		return x <= n, nil
+	}
+
+	return validateLen(v) >= 0 && x == n, nil
+}
@@ -0,0 +1,148 @@
+package sdk_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/brick-io/brock/sdk"
+	. "github.com/onsi/gomega"
+)
+
+//nolint:funlen
+func Test_sdkvalidate(t *testing.T) {
+	t.Parallel()
+	Expect := NewWithT(t).Expect
+
+	type Address struct {
+		City string `validate:"required"`
+		Zip  string `validate:"omitempty,len=5,regex=^[0-9,]+$"`
+	}
+
+	type input struct {
+		Name    string   `validate:"required,min=3,max=8"`
+		Email   string   `validate:"required,email"`
+		Age     int      `validate:"min=18,max=99"`
+		Role    string   `validate:"oneof=admin member"`
+		Tags    []string `validate:"max=2,dive,required,regex=^[a-z]+$"`
+		Address Address
+		Backup  *Address
+		Others  []Address         `validate:"dive"`
+		Labels  map[string]string `validate:"dive,max=3"`
+		Ignored string            `validate:"-"`
+	}
+
+	valid := input{
+		Name:    "brock",
+		Email:   "brock@example.com",
+		Age:     30,
+		Role:    "admin",
+		Tags:    []string{"go", "http"},
+		Address: Address{City: "Jakarta", Zip: "12345"},
+		Labels:  map[string]string{"a": "abc"},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		Expect(Validate(valid)).To(Succeed())
+		Expect(Validate(&valid)).To(Succeed())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		in := valid
+		in.Name = "br"
+		in.Email = "Brock <brock@example.com>"
+		in.Age = 17
+		in.Role = "owner"
+		in.Tags = []string{"go", "", "HTTP"}
+		in.Address = Address{Zip: "12a45"}
+		in.Backup = &Address{City: "Bandung", Zip: "123"}
+		in.Others = []Address{{City: "Bogor"}, {}}
+		in.Labels = map[string]string{"a": "abcd"}
+
+		err := Validate(in)
+		Expect(err).To(MatchError(ErrValidation))
+
+		var errs Errors
+
+		Expect(errors.As(err, &errs)).To(BeTrue())
+
+		fields := make(map[string]string)
+
+		for _, err := range errs {
+			var fieldErr *FieldError
+
+			Expect(errors.As(err, &fieldErr)).To(BeTrue())
+			fields[fieldErr.Field] += fieldErr.Rule + ";"
+		}
+
+		Expect(fields).To(Equal(map[string]string{
+			"Name":           "min;",
+			"Email":          "email;",
+			"Age":            "min;",
+			"Role":           "oneof;",
+			"Tags":           "max;",
+			"Tags[1]":        "required;",
+			"Tags[2]":        "regex;",
+			"Address.City":   "required;",
+			"Address.Zip":    "regex;",
+			"Backup.Zip":     "len;",
+			"Others[1].City": "required;",
+			"Labels[a]":      "max;",
+		}))
+
+		Expect(errs[0].Error()).To(Equal("Name must be at least 3"))
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		t.Parallel()
+
+		type zero struct {
+			Age     int    `validate:"min=18"`
+			Role    string `validate:"oneof=admin member"`
+			Level   *int   `validate:"max=3"`
+			Referer string `validate:"omitempty,email"`
+		}
+
+		err := Validate(zero{})
+		Expect(err).To(MatchError(ErrValidation))
+
+		var errs Errors
+
+		Expect(errors.As(err, &errs)).To(BeTrue())
+		Expect(errs).To(HaveLen(3))
+		Expect(errs.Error()).To(ContainSubstring("Age must be at least 18"))
+		Expect(errs.Error()).To(ContainSubstring("Role must be one of [admin member]"))
+		Expect(errs.Error()).To(ContainSubstring("Level must be at most 3"))
+	})
+
+	t.Run("rule", func(t *testing.T) {
+		t.Parallel()
+
+		for msg, v := range map[string]any{
+			"A: min: unsupported type: bool": struct {
+				A bool `validate:"min=1"`
+			}{true},
+			"A: min: invalid param: one": struct {
+				A int `validate:"min=one"`
+			}{},
+			"A: unknown rule: unknown": struct {
+				A string `validate:"unknown"`
+			}{"a"},
+			"A: regex: error parsing regexp": struct {
+				A string `validate:"regex=^[a-z"`
+			}{"a"},
+			"A: dive: unsupported type: int": struct {
+				A int `validate:"dive,required"`
+			}{},
+		} {
+			err := Validate(v)
+			Expect(err).To(MatchError(ErrValidationRule), msg)
+			Expect(err).NotTo(MatchError(ErrValidation), msg)
+			Expect(err.Error()).To(HavePrefix("brock/sdk: invalid validation rule: "+msg), msg)
+		}
+	})
+
+}